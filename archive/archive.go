@@ -0,0 +1,288 @@
+// Package archive provides an fs.FS that presents zip and tar archives as
+// directories, so that checksum.Walk() can checksum archive members without
+// extracting them.
+//
+// For each archive file in the underlying FS (e.g., "bundle.tar"), the FS
+// includes a directory with the same name and a "!" suffix ("bundle.tar!")
+// holding the archive's contents. The member "dir/file.txt" in bundle.tar
+// has the path "bundle.tar!/dir/file.txt". Archives are recognized by their
+// extension: .zip, .tar, .tar.gz, .tgz, .tar.zst, and .tzst. Archives inside
+// archives are not expanded.
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sep is the suffix added to archive names to form the name of the directory
+// containing the archive's contents.
+const Sep = `!`
+
+var archiveExts = []string{`.zip`, `.tar`, `.tar.gz`, `.tgz`, `.tar.zst`, `.tzst`}
+
+// IsArchive returns true if name has an archive file extension.
+func IsArchive(name string) bool {
+	return archiveExt(name) != ""
+}
+
+func archiveExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// FS is an fs.FS that presents archives in an underlying fs.FS as
+// directories. Archive indexes are cached, and archive files may be kept
+// open: Close() should be called to release them. FS is safe for concurrent
+// use.
+type FS struct {
+	fsys     fs.FS
+	mx       sync.Mutex
+	archives map[string]fs.FS // archive contents by archive path
+	closers  []io.Closer
+}
+
+var _ fs.ReadDirFS = (*FS)(nil)
+
+// New returns a new FS for the archives in fsys.
+func New(fsys fs.FS) *FS {
+	return &FS{
+		fsys:     fsys,
+		archives: make(map[string]fs.FS),
+	}
+}
+
+// Open implements fs.FS
+func (afs *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: `open`, Path: name, Err: fs.ErrInvalid}
+	}
+	archive, member, ok := splitArchivePath(name)
+	if ok {
+		members, err := afs.archive(archive)
+		if err != nil {
+			return nil, &fs.PathError{Op: `open`, Path: name, Err: err}
+		}
+		f, err := members.Open(member)
+		if err != nil {
+			return nil, &fs.PathError{Op: `open`, Path: name, Err: unwrapPathErr(err)}
+		}
+		return f, nil
+	}
+	f, err := afs.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if dir, ok := f.(fs.ReadDirFile); ok {
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if info.IsDir() {
+			return &dirFile{ReadDirFile: dir, afs: afs, name: name}, nil
+		}
+	}
+	return f, nil
+}
+
+// ReadDir implements fs.ReadDirFS. Entries for archive directories are
+// included after the corresponding archive files.
+func (afs *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: `readdir`, Path: name, Err: fs.ErrInvalid}
+	}
+	if archive, member, ok := splitArchivePath(name); ok {
+		members, err := afs.archive(archive)
+		if err != nil {
+			return nil, &fs.PathError{Op: `readdir`, Path: name, Err: err}
+		}
+		entries, err := fs.ReadDir(members, member)
+		if err != nil {
+			return nil, &fs.PathError{Op: `readdir`, Path: name, Err: unwrapPathErr(err)}
+		}
+		return entries, nil
+	}
+	entries, err := fs.ReadDir(afs.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return withArchiveDirs(entries), nil
+}
+
+// Close closes any archive files kept open by the FS and clears the cache
+func (afs *FS) Close() error {
+	afs.mx.Lock()
+	defer afs.mx.Unlock()
+	var errs []error
+	for _, c := range afs.closers {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	afs.closers = nil
+	afs.archives = make(map[string]fs.FS)
+	return errors.Join(errs...)
+}
+
+// archive returns an fs.FS for the contents of the named archive file
+func (afs *FS) archive(name string) (fs.FS, error) {
+	afs.mx.Lock()
+	defer afs.mx.Unlock()
+	if members, ok := afs.archives[name]; ok {
+		return members, nil
+	}
+	var members fs.FS
+	var err error
+	if archiveExt(name) == `.zip` {
+		members, err = afs.openZip(name)
+	} else {
+		members, err = afs.openTar(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	afs.archives[name] = members
+	return members, nil
+}
+
+// openZip returns the contents of the zip file. If the underlying file
+// doesn't implement io.ReaderAt, it is read into memory.
+func (afs *FS) openZip(name string) (fs.FS, error) {
+	f, err := afs.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ra, ok := f.(io.ReaderAt)
+	if ok {
+		afs.closers = append(afs.closers, f)
+	} else {
+		b, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		ra = bytes.NewReader(b)
+	}
+	return zip.NewReader(ra, info.Size())
+}
+
+// splitArchivePath splits name into the path of an archive and the path of a
+// member inside it. The boolean is false if name is not inside an archive.
+func splitArchivePath(name string) (string, string, bool) {
+	parts := strings.Split(name, "/")
+	for i, p := range parts {
+		if strings.HasSuffix(p, Sep) && IsArchive(strings.TrimSuffix(p, Sep)) {
+			archive := strings.TrimSuffix(path.Join(parts[:i+1]...), Sep)
+			member := path.Join(parts[i+1:]...)
+			if member == "" {
+				member = "."
+			}
+			return archive, member, true
+		}
+	}
+	return "", "", false
+}
+
+// unwrapPathErr returns the underlying error from a *fs.PathError from
+// an archive, so it can be re-wrapped with the full path.
+func unwrapPathErr(err error) error {
+	var perr *fs.PathError
+	if errors.As(err, &perr) {
+		return perr.Err
+	}
+	return err
+}
+
+// withArchiveDirs adds archive directory entries to entries
+func withArchiveDirs(entries []fs.DirEntry) []fs.DirEntry {
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e)
+		if e.Type().IsRegular() && IsArchive(e.Name()) {
+			result = append(result, archiveDirEntry{file: e})
+		}
+	}
+	return result
+}
+
+// dirFile wraps directories from the underlying FS so that archive
+// directories are included in ReadDir
+type dirFile struct {
+	fs.ReadDirFile
+	afs  *FS
+	name string
+	// pending archive dir entry from previous call to ReadDir
+	pending []fs.DirEntry
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries, err := d.ReadDirFile.ReadDir(n)
+		entries = append(d.pending, withArchiveDirs(entries)...)
+		d.pending = nil
+		return entries, err
+	}
+	entries := d.pending
+	d.pending = nil
+	var err error
+	if len(entries) < n {
+		var more []fs.DirEntry
+		more, err = d.ReadDirFile.ReadDir(n - len(entries))
+		entries = append(entries, withArchiveDirs(more)...)
+	}
+	if len(entries) > n {
+		d.pending = entries[n:]
+		entries = entries[:n]
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	return entries, err
+}
+
+// archiveDirEntry is the directory entry for an archive's contents
+type archiveDirEntry struct {
+	file fs.DirEntry // the archive file's entry
+}
+
+func (e archiveDirEntry) Name() string      { return e.file.Name() + Sep }
+func (e archiveDirEntry) IsDir() bool       { return true }
+func (e archiveDirEntry) Type() fs.FileMode { return fs.ModeDir }
+func (e archiveDirEntry) Info() (fs.FileInfo, error) {
+	info, err := e.file.Info()
+	if err != nil {
+		return nil, err
+	}
+	return dirInfo{name: e.Name(), modTime: info.ModTime()}, nil
+}
+
+// dirInfo is the fs.FileInfo for implicit directories
+type dirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (i dirInfo) Name() string       { return i.name }
+func (i dirInfo) Size() int64        { return 0 }
+func (i dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (i dirInfo) ModTime() time.Time { return i.modTime }
+func (i dirInfo) IsDir() bool        { return true }
+func (i dirInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,319 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/archive"
+)
+
+var testMD5Sums = map[string]string{
+	"folder1/folder2/sculpture-stone-face-head-888027.jpg": "e8c078f0e4ad79b16fcb618a3790c2df",
+	"folder1/folder2/file2.txt":                            "d41d8cd98f00b204e9800998ecf8427e",
+	"folder1/file.txt":                                     "d41d8cd98f00b204e9800998ecf8427e",
+	"hello.csv":                                            "9d02fa6e9dd9f38327f7b213daa28be6",
+}
+
+// writeTar writes the test fixture files to w as a tar archive
+func writeTar(t *testing.T, w io.Writer) {
+	t.Helper()
+	fixture := os.DirFS("../test/fixture")
+	tw := tar.NewWriter(w)
+	for name := range testMD5Sums {
+		b, err := fs.ReadFile(fixture, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hdr := &tar.Header{Name: "./" + name, Mode: 0644, Size: int64(len(b)), ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeZip(t *testing.T, w io.Writer) {
+	t.Helper()
+	fixture := os.DirFS("../test/fixture")
+	zw := zip.NewWriter(w)
+	for name := range testMD5Sums {
+		b, err := fs.ReadFile(fixture, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createFile(t *testing.T, name string, write func(io.Writer)) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	write(f)
+}
+
+func TestWalkArchives(t *testing.T) {
+	dir := t.TempDir()
+	createFile(t, filepath.Join(dir, "a.tar"), func(w io.Writer) { writeTar(t, w) })
+	createFile(t, filepath.Join(dir, "b.zip"), func(w io.Writer) { writeZip(t, w) })
+	createFile(t, filepath.Join(dir, "c.tar.gz"), func(w io.Writer) {
+		gz := gzip.NewWriter(w)
+		writeTar(t, gz)
+		gz.Close()
+	})
+	createFile(t, filepath.Join(dir, "d.tar.zst"), func(w io.Writer) {
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTar(t, zw)
+		zw.Close()
+	})
+	afs := archive.New(os.DirFS(dir))
+	defer afs.Close()
+	got := map[string]string{}
+	each := func(j checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		got[j.Path()], err = j.SumString(checksum.MD5)
+		return err
+	}
+	if err := checksum.Walk(afs, ".", each, checksum.WithMD5()); err != nil {
+		t.Fatal(err)
+	}
+	// 4 archives + 4 members each
+	if len(got) != 20 {
+		t.Errorf("expected 20 results, got %d: %v", len(got), got)
+	}
+	for _, arch := range []string{"a.tar", "b.zip", "c.tar.gz", "d.tar.zst"} {
+		for name, sum := range testMD5Sums {
+			p := arch + archive.Sep + "/" + name
+			if got[p] != sum {
+				t.Errorf("expected %s for %s, got %q", sum, p, got[p])
+			}
+		}
+	}
+	if _, err := fs.Stat(afs, "a.tar!/nothing"); err == nil {
+		t.Error("expected an error for missing member")
+	}
+}
+
+// countFS counts calls to Open for each name and bytes read from files
+type countFS struct {
+	fs.FS
+	mx     sync.Mutex
+	counts map[string]int
+	read   int64
+}
+
+func (c *countFS) Open(name string) (fs.File, error) {
+	c.mx.Lock()
+	c.counts[name]++
+	c.mx.Unlock()
+	f, err := c.FS.Open(name)
+	if osFile, ok := f.(*os.File); ok {
+		return &countFile{File: osFile, fsys: c}, nil
+	}
+	return f, err
+}
+
+// countFile adds bytes read with Read to its countFS
+type countFile struct {
+	*os.File
+	fsys *countFS
+}
+
+func (f *countFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.fsys.mx.Lock()
+	f.fsys.read += int64(n)
+	f.fsys.mx.Unlock()
+	return n, err
+}
+
+func TestTarIndex(t *testing.T) {
+	dir := t.TempDir()
+	big := bytes.Repeat([]byte("0123456789"), 100*1024)
+	createFile(t, filepath.Join(dir, "a.tar"), func(w io.Writer) {
+		tw := tar.NewWriter(w)
+		// the second header for small replaces the first
+		replaced := false
+		for _, name := range []string{"big1", "big2", "small", "small"} {
+			b := big
+			if name == "small" {
+				b = []byte("small")
+				if replaced {
+					b = []byte("replaced small")
+				}
+				replaced = true
+			}
+			if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(b))}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tw.Close()
+	})
+	cfs := &countFS{FS: os.DirFS(dir), counts: map[string]int{}}
+	afs := archive.New(cfs)
+	defer afs.Close()
+	b, err := fs.ReadFile(afs, "a.tar!/small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "replaced small" {
+		t.Errorf("unexpected content: %q", b)
+	}
+	entries, err := fs.ReadDir(afs, "a.tar!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %v", entries)
+	}
+	if info, err := entries[2].Info(); err != nil || info.Size() != int64(len(b)) {
+		t.Errorf("stale directory entry for replaced member: %v, %v", info, err)
+	}
+	// member content is skipped when indexing
+	if cfs.read > int64(len(big)) {
+		t.Errorf("read %d bytes to index the archive", cfs.read)
+	}
+	b, err = fs.ReadFile(afs, "a.tar!/big2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, big) {
+		t.Error("unexpected content for big2")
+	}
+}
+
+func TestTarHardLink(t *testing.T) {
+	dir := t.TempDir()
+	write := func(w io.Writer) {
+		tw := tar.NewWriter(w)
+		content := []byte("hello")
+		if err := tw.WriteHeader(&tar.Header{Name: "./a.txt", Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+		for name, target := range map[string]string{"b.txt": "./a.txt", "dangling.txt": "missing.txt"} {
+			hdr := &tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target, Mode: 0644}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tw.Close()
+	}
+	createFile(t, filepath.Join(dir, "x.tar"), write)
+	createFile(t, filepath.Join(dir, "x.tar.gz"), func(w io.Writer) {
+		gz := gzip.NewWriter(w)
+		write(gz)
+		gz.Close()
+	})
+	afs := archive.New(os.DirFS(dir))
+	defer afs.Close()
+	got := map[string]string{}
+	each := func(j checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		got[j.Path()], err = j.SumString(checksum.MD5)
+		return err
+	}
+	if err := checksum.Walk(afs, ".", each, checksum.WithMD5()); err != nil {
+		t.Fatal(err)
+	}
+	const helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+	for _, arch := range []string{"x.tar", "x.tar.gz"} {
+		for _, name := range []string{"a.txt", "b.txt"} {
+			p := arch + archive.Sep + "/" + name
+			if got[p] != helloMD5 {
+				t.Errorf("expected %s for %s, got %q", helloMD5, p, got[p])
+			}
+		}
+		// links to missing members aren't regular files
+		if d, ok := got[arch+archive.Sep+"/dangling.txt"]; ok {
+			t.Errorf("unexpected result for dangling link: %s", d)
+		}
+	}
+	info, err := fs.Stat(afs, "x.tar!/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "b.txt" || info.Size() != 5 {
+		t.Errorf("unexpected info for hard link: %s, %d", info.Name(), info.Size())
+	}
+}
+
+func TestWalkCompressedTar(t *testing.T) {
+	dir := t.TempDir()
+	const members = 200
+	createFile(t, filepath.Join(dir, "a.tar.gz"), func(w io.Writer) {
+		gz := gzip.NewWriter(w)
+		tw := tar.NewWriter(gz)
+		for i := 0; i < members; i++ {
+			b := []byte(fmt.Sprintf("file %d", i))
+			hdr := &tar.Header{Name: fmt.Sprintf("f%03d", i), Mode: 0644, Size: int64(len(b))}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tw.Close()
+		gz.Close()
+	})
+	cfs := &countFS{FS: os.DirFS(dir), counts: map[string]int{}}
+	afs := archive.New(cfs)
+	defer afs.Close()
+	count := 0
+	each := func(j checksum.Job, err error) error {
+		count++
+		return err
+	}
+	if err := checksum.Walk(afs, ".", each, checksum.WithMD5(), checksum.WithGos(4)); err != nil {
+		t.Fatal(err)
+	}
+	if count != members+1 {
+		t.Errorf("expected %d results, got %d", members+1, count)
+	}
+	// the archive is reopened for each concurrent reader, not for each member
+	if n := cfs.counts["a.tar.gz"]; n > 20 {
+		t.Errorf("archive opened %d times for %d members", n, members)
+	}
+}
@@ -0,0 +1,409 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// tarFS is an fs.FS for the contents of a tar archive. It is built from an
+// index of the archive's headers. For uncompressed archives in files that
+// implement io.ReaderAt, members are read directly from the archive file.
+// Otherwise, members are read from decompressed streams of the archive.
+// Streams are reused when their members are closed, so that reading members
+// in archive order (e.g., with Walk) only decompresses the archive once per
+// concurrent reader.
+type tarFS struct {
+	afs     *FS    // for reopening the archive
+	name    string // archive path in afs.fsys
+	ra      io.ReaderAt
+	entries map[string]*tarEntry
+
+	mx      sync.Mutex
+	streams []*tarStream // idle streams
+	closed  bool
+}
+
+// tarStream is an open tar stream for reading members sequentially
+type tarStream struct {
+	tr    *tar.Reader
+	pos   int // index of the last header read, or -1
+	close func() error
+}
+
+// tarEntry is an indexed file or directory in a tar archive
+type tarEntry struct {
+	info     fs.FileInfo
+	index    int   // position of the header in the archive
+	offset   int64 // offset of file content (if ra is set)
+	children []fs.DirEntry
+}
+
+// openTar indexes the named tar archive
+func (afs *FS) openTar(name string) (fs.FS, error) {
+	f, err := afs.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	archInfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	tfs := &tarFS{
+		afs:  afs,
+		name: name,
+		entries: map[string]*tarEntry{
+			".": {info: dirInfo{name: ".", modTime: archInfo.ModTime()}},
+		},
+	}
+	ra, isReaderAt := f.(io.ReaderAt)
+	direct := isReaderAt && archiveExt(name) == `.tar`
+	counter := &countReader{r: f}
+	var src io.Reader = counter
+	if seeker, ok := f.(io.Seeker); ok && archiveExt(name) == `.tar` {
+		// tar.Reader seeks past the content of members
+		src = &countSeeker{countReader: counter, s: seeker}
+	}
+	r, closeDecomp, err := decompress(name, src)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	tr := tar.NewReader(r)
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			closeDecomp()
+			f.Close()
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		p := cleanMemberPath(hdr.Name)
+		if p == "" {
+			continue
+		}
+		entry := &tarEntry{info: hdr.FileInfo(), index: i, offset: counter.n}
+		switch hdr.Typeflag {
+		case tar.TypeGNUSparse:
+			direct = false // sparse file content isn't contiguous
+		case tar.TypeLink:
+			// hard links share the content of an earlier member
+			target, ok := tfs.entries[cleanMemberPath(hdr.Linkname)]
+			if ok && target.info.Mode().IsRegular() {
+				entry.info, entry.index, entry.offset = target.info, target.index, target.offset
+			} else {
+				entry.info = irregularInfo{FileInfo: entry.info}
+			}
+		}
+		tfs.add(p, entry)
+	}
+	closeDecomp()
+	if direct {
+		tfs.ra = ra
+		afs.closers = append(afs.closers, f)
+	} else {
+		f.Close()
+		afs.closers = append(afs.closers, tfs)
+	}
+	for _, e := range tfs.entries {
+		sort.Slice(e.children, func(i, j int) bool {
+			return e.children[i].Name() < e.children[j].Name()
+		})
+	}
+	return tfs, nil
+}
+
+// add adds the entry to the index, creating implicit parent directories as
+// needed.
+func (tfs *tarFS) add(p string, entry *tarEntry) {
+	if existing, ok := tfs.entries[p]; ok {
+		// later headers replace earlier ones
+		existing.info, existing.index, existing.offset = entry.info, entry.index, entry.offset
+		parent := tfs.entries[path.Dir(p)]
+		for i, child := range parent.children {
+			if child.Name() == path.Base(p) {
+				parent.children[i] = dirEntry(p, entry.info)
+				break
+			}
+		}
+		return
+	}
+	tfs.entries[p] = entry
+	for {
+		parent := path.Dir(p)
+		parentEntry, exists := tfs.entries[parent]
+		if !exists {
+			parentEntry = &tarEntry{info: dirInfo{name: path.Base(parent), modTime: entry.info.ModTime()}}
+			tfs.entries[parent] = parentEntry
+		}
+		parentEntry.children = append(parentEntry.children, dirEntry(p, tfs.entries[p].info))
+		if exists {
+			return
+		}
+		p = parent
+	}
+}
+
+// dirEntry returns the directory entry for the member with path p
+func dirEntry(p string, info fs.FileInfo) fs.DirEntry {
+	return fs.FileInfoToDirEntry(namedInfo{FileInfo: info, name: path.Base(p)})
+}
+
+func (tfs *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: `open`, Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := tfs.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: `open`, Path: name, Err: fs.ErrNotExist}
+	}
+	info := namedInfo{FileInfo: entry.info, name: path.Base(name)}
+	if entry.info.IsDir() {
+		return &tarDir{info: info, entries: entry.children}, nil
+	}
+	if tfs.ra != nil {
+		return &tarSectionFile{
+			SectionReader: io.NewSectionReader(tfs.ra, entry.offset, entry.info.Size()),
+			info:          info,
+		}, nil
+	}
+	return tfs.scan(entry, info)
+}
+
+// scan returns the entry's file from a tar stream positioned before it. The
+// stream is returned to the idle streams when the file is closed.
+func (tfs *tarFS) scan(entry *tarEntry, info fs.FileInfo) (fs.File, error) {
+	s, err := tfs.stream(entry.index)
+	if err != nil {
+		return nil, err
+	}
+	for s.pos < entry.index {
+		if _, err := s.tr.Next(); err != nil {
+			s.close()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("reading %s: %w", tfs.name, err)
+		}
+		s.pos++
+	}
+	return &tarFile{r: s.tr, info: info, close: func() error {
+		return tfs.release(s)
+	}}, nil
+}
+
+// stream removes and returns the idle stream that is closest to, but before,
+// the header with the given index. If there isn't one, the archive is
+// reopened.
+func (tfs *tarFS) stream(index int) (*tarStream, error) {
+	tfs.mx.Lock()
+	best := -1
+	for i, s := range tfs.streams {
+		if s.pos < index && (best < 0 || s.pos > tfs.streams[best].pos) {
+			best = i
+		}
+	}
+	if best >= 0 {
+		s := tfs.streams[best]
+		tfs.streams = append(tfs.streams[:best], tfs.streams[best+1:]...)
+		tfs.mx.Unlock()
+		return s, nil
+	}
+	tfs.mx.Unlock()
+	f, err := tfs.afs.fsys.Open(tfs.name)
+	if err != nil {
+		return nil, err
+	}
+	r, closeDecomp, err := decompress(tfs.name, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &tarStream{
+		tr:  tar.NewReader(r),
+		pos: -1,
+		close: func() error {
+			closeDecomp()
+			return f.Close()
+		},
+	}, nil
+}
+
+// release returns s to the idle streams
+func (tfs *tarFS) release(s *tarStream) error {
+	tfs.mx.Lock()
+	defer tfs.mx.Unlock()
+	if tfs.closed {
+		return s.close()
+	}
+	tfs.streams = append(tfs.streams, s)
+	return nil
+}
+
+// Close closes the idle streams. Streams in use are closed when their files
+// are closed.
+func (tfs *tarFS) Close() error {
+	tfs.mx.Lock()
+	defer tfs.mx.Unlock()
+	var errs []error
+	for _, s := range tfs.streams {
+		if err := s.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	tfs.streams = nil
+	tfs.closed = true
+	return errors.Join(errs...)
+}
+
+// decompress returns a reader for the uncompressed tar stream in r based on
+// the name's extension.
+func decompress(name string, r io.Reader) (io.Reader, func(), error) {
+	switch archiveExt(name) {
+	case `.tar.gz`, `.tgz`:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		return gz, func() { gz.Close() }, nil
+	case `.tar.zst`, `.tzst`:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		return zr, zr.Close, nil
+	}
+	return r, func() {}, nil
+}
+
+// cleanMemberPath returns a valid fs.FS path for the tar header name, or ""
+// if the name is the archive root or is invalid.
+func cleanMemberPath(name string) string {
+	name = strings.TrimLeft(name, "/")
+	if name == "" {
+		return ""
+	}
+	name = path.Clean(name)
+	if name == "." || !fs.ValidPath(name) {
+		return ""
+	}
+	return name
+}
+
+// countReader counts bytes read from r
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countSeeker is a countReader for an io.Seeker. Seeking sets the count to
+// the new offset.
+type countSeeker struct {
+	*countReader
+	s io.Seeker
+}
+
+func (c *countSeeker) Seek(offset int64, whence int) (int64, error) {
+	n, err := c.s.Seek(offset, whence)
+	if err == nil {
+		c.n = n
+	}
+	return n, err
+}
+
+// namedInfo overrides the name of an fs.FileInfo
+type namedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i namedInfo) Name() string { return i.name }
+
+// irregularInfo marks an fs.FileInfo as an irregular file, for members with
+// content that can't be read (e.g., hard links to missing members)
+type irregularInfo struct {
+	fs.FileInfo
+}
+
+func (i irregularInfo) Mode() fs.FileMode { return i.FileInfo.Mode() | fs.ModeIrregular }
+
+// tarFile is a member file read from a tar stream
+type tarFile struct {
+	r     io.Reader
+	info  fs.FileInfo
+	close func() error
+}
+
+func (f *tarFile) Read(p []byte) (int, error) {
+	if f.close == nil {
+		return 0, fs.ErrClosed
+	}
+	return f.r.Read(p)
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *tarFile) Close() error {
+	if f.close == nil {
+		return fs.ErrClosed
+	}
+	err := f.close()
+	f.close = nil
+	return err
+}
+
+// tarSectionFile is a member file read directly from an uncompressed archive
+type tarSectionFile struct {
+	*io.SectionReader
+	info fs.FileInfo
+}
+
+func (f *tarSectionFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *tarSectionFile) Close() error               { return nil }
+
+// tarDir is a directory in a tar archive
+type tarDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *tarDir) Close() error               { return nil }
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: `read`, Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return append([]fs.DirEntry(nil), rest...), nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return append([]fs.DirEntry(nil), rest[:n]...), nil
+}
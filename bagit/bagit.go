@@ -0,0 +1,475 @@
+// Package bagit creates and validates BagIt bags (RFC 8493) using concurrent
+// checksums from the checksum package.
+package bagit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/delta"
+)
+
+const (
+	version      = `1.0`
+	payloadDir   = `data`
+	bagitFile    = `bagit.txt`
+	bagInfoFile  = `bag-info.txt`
+	fetchFile    = `fetch.txt`
+	manifestPre  = `manifest-`
+	tagManifest  = `tagmanifest-`
+	manifestExt  = `.txt`
+	oxumLabel    = `Payload-Oxum`
+	dateLabel    = `Bagging-Date`
+	defaultAlg   = checksum.SHA512
+	dateFormat   = `2006-01-02`
+	bagitContent = "BagIt-Version: " + version + "\nTag-File-Character-Encoding: UTF-8\n"
+)
+
+// Info holds metadata for the bag-info.txt tag file. Labels may be repeated
+// with multiple values.
+type Info map[string][]string
+
+// Create makes a bag in place: the existing contents of dir are moved to the
+// data/ payload directory and the manifest, tag manifest, bagit.txt and
+// bag-info.txt tag files are created. Manifests are created for each named
+// algorithm in algs (sha512 if algs is empty). Payload-Oxum and Bagging-Date
+// are added to info if not set. Optional arguments are passed to
+// checksum.Walk() (e.g., checksum.WithGos()). Algorithm names are resolved
+// with checksum.Lookup().
+func Create(dir string, algNames []string, info Info, opts ...func(*checksum.Config)) error {
+	if len(algNames) == 0 {
+		algNames = []string{defaultAlg}
+	}
+	opts = append([]func(*checksum.Config){}, opts...)
+	for _, name := range algNames {
+		alg, err := checksum.Lookup(name)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, checksum.WithAlg(alg.Name, alg.New))
+	}
+	if err := movePayload(dir); err != nil {
+		return err
+	}
+	fsys := os.DirFS(dir)
+	manifests, oxum, err := checksumPayload(fsys, opts...)
+	if err != nil {
+		return err
+	}
+	for alg, files := range manifests {
+		name := filepath.Join(dir, manifestPre+alg+manifestExt)
+		if err := writeManifest(name, files); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, bagitFile), []byte(bagitContent), 0644); err != nil {
+		return err
+	}
+	newInfo := Info{}
+	for label, vals := range info {
+		newInfo[label] = vals
+	}
+	if len(newInfo[oxumLabel]) == 0 {
+		newInfo[oxumLabel] = []string{oxum.String()}
+	}
+	if len(newInfo[dateLabel]) == 0 {
+		newInfo[dateLabel] = []string{time.Now().Format(dateFormat)}
+	}
+	if err := writeInfo(filepath.Join(dir, bagInfoFile), newInfo); err != nil {
+		return err
+	}
+	// tag manifest includes all tag files except tag manifests
+	tagFiles := map[string]delta.FileSet{}
+	each := func(j checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		for alg, sum := range j.Sums() {
+			if tagFiles[alg] == nil {
+				tagFiles[alg] = delta.FileSet{}
+			}
+			tagFiles[alg][j.Path()] = fmt.Sprintf("%x", sum)
+		}
+		return nil
+	}
+	walkFunc := func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && name == payloadDir {
+			return fs.SkipDir
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(name, tagManifest) {
+			return checksum.ErrSkipFile
+		}
+		return nil
+	}
+	opts = append(opts, checksum.WithWalkDirFunc(walkFunc))
+	if err := checksum.Walk(fsys, `.`, each, opts...); err != nil {
+		return err
+	}
+	for alg, files := range tagFiles {
+		name := filepath.Join(dir, tagManifest+alg+manifestExt)
+		if err := writeManifest(name, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that the bag in fsys is complete and valid: bagit.txt is
+// present, every payload file is listed in every payload manifest, every file
+// listed in a manifest exists, all checksums match, and Payload-Oxum (if
+// present) matches the payload. Bags with fetch.txt are not supported.
+// Optional arguments are passed to checksum.Walk() and checksum.NewPipe().
+// If the bag is invalid, the returned error is a *ValidationError.
+func Validate(fsys fs.FS, opts ...func(*checksum.Config)) error {
+	verr := &ValidationError{}
+	if err := readBagitTxt(fsys); err != nil {
+		verr.Errs = append(verr.Errs, err)
+		return verr
+	}
+	if _, err := fs.Stat(fsys, fetchFile); err == nil {
+		return errors.New(`bags with fetch.txt are not supported`)
+	}
+	manifests, err := readManifests(fsys, manifestPre)
+	if err != nil {
+		return err
+	}
+	if len(manifests) == 0 {
+		verr.Errs = append(verr.Errs, errors.New(`no payload manifest found`))
+		return verr
+	}
+	walkOpts := append([]func(*checksum.Config){}, opts...)
+	for name, newHash := range manifestAlgs(manifests) {
+		walkOpts = append(walkOpts, checksum.WithAlg(name, newHash))
+	}
+	found, oxum, err := checksumPayload(fsys, walkOpts...)
+	if err != nil {
+		return err
+	}
+	for alg, expected := range manifests {
+		for name, sum := range found[alg] {
+			if _, ok := expected[name]; !ok {
+				verr.Errs = append(verr.Errs, fmt.Errorf("%s: not in %s%s%s", name, manifestPre, alg, manifestExt))
+				continue
+			}
+			if expected[name] != sum {
+				verr.Errs = append(verr.Errs, fmt.Errorf("%s: %s checksum mismatch", name, alg))
+			}
+		}
+		for name := range expected {
+			if _, ok := found[alg][name]; !ok {
+				verr.Errs = append(verr.Errs, fmt.Errorf("%s: in %s%s%s but not found", name, manifestPre, alg, manifestExt))
+			}
+		}
+	}
+	info, err := readInfo(fsys)
+	if err != nil {
+		return err
+	}
+	if vals := info[oxumLabel]; len(vals) > 0 && vals[0] != oxum.String() {
+		verr.Errs = append(verr.Errs, fmt.Errorf("%s is %s but payload is %s", oxumLabel, vals[0], oxum))
+	}
+	tagManifests, err := readManifests(fsys, tagManifest)
+	if err != nil {
+		return err
+	}
+	tagAlgs := manifestAlgs(tagManifests)
+	for alg, files := range tagManifests {
+		verifyOpts := append([]func(*checksum.Config){}, opts...)
+		verifyOpts = append(verifyOpts, checksum.WithAlg(alg, tagAlgs[alg]))
+		results, err := checksum.Verify(fsys, files, verifyOpts...)
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			if r.Status != checksum.VerifyOK {
+				verr.Errs = append(verr.Errs, fmt.Errorf("%s: %s %s", r.Path, alg, r.Status))
+			}
+		}
+	}
+	if len(verr.Errs) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// ValidationError lists the problems found by Validate()
+type ValidationError struct {
+	Errs []error
+}
+
+// Error implements error interface for ValidationError
+func (ve *ValidationError) Error() string {
+	var m []string
+	for _, err := range ve.Errs {
+		m = append(m, err.Error())
+	}
+	return "invalid bag: " + strings.Join(m, `; `)
+}
+
+// Oxum is the octetstream sum of a payload: the total number of bytes and
+// number of files.
+type Oxum struct {
+	Bytes int64
+	Files int
+}
+
+// String returns the Payload-Oxum value
+func (o Oxum) String() string {
+	return fmt.Sprintf("%d.%d", o.Bytes, o.Files)
+}
+
+// checksumPayload walks the payload directory in fsys and returns a FileSet
+// for each algorithm and the payload's Oxum.
+func checksumPayload(fsys fs.FS, opts ...func(*checksum.Config)) (map[string]delta.FileSet, Oxum, error) {
+	var oxum Oxum
+	manifests := map[string]delta.FileSet{}
+	each := func(j checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		oxum.Bytes += j.Info().Size()
+		oxum.Files++
+		for alg, sum := range j.Sums() {
+			if manifests[alg] == nil {
+				manifests[alg] = delta.FileSet{}
+			}
+			manifests[alg][j.Path()] = fmt.Sprintf("%x", sum)
+		}
+		return nil
+	}
+	if err := checksum.Walk(fsys, payloadDir, each, opts...); err != nil {
+		return nil, oxum, err
+	}
+	return manifests, oxum, nil
+}
+
+// movePayload moves the contents of dir to dir/data
+func movePayload(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(dir, `.bagit-`)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.Rename(filepath.Join(dir, e.Name()), filepath.Join(tmp, e.Name())); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, payloadDir))
+}
+
+func readBagitTxt(fsys fs.FS) error {
+	f, err := fsys.Open(bagitFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tags, err := readTags(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", bagitFile, err)
+	}
+	if len(tags[`BagIt-Version`]) != 1 {
+		return fmt.Errorf("%s: missing BagIt-Version", bagitFile)
+	}
+	enc := tags[`Tag-File-Character-Encoding`]
+	if len(enc) != 1 || !strings.EqualFold(enc[0], `UTF-8`) {
+		return fmt.Errorf("%s: missing or unsupported Tag-File-Character-Encoding", bagitFile)
+	}
+	return nil
+}
+
+func readInfo(fsys fs.FS) (Info, error) {
+	f, err := fsys.Open(bagInfoFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Info{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	info, err := readTags(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", bagInfoFile, err)
+	}
+	return info, nil
+}
+
+// readTags parses a tag file with "Label: Value" lines. Lines beginning with
+// whitespace continue the previous value.
+func readTags(r io.Reader) (Info, error) {
+	tags := Info{}
+	var last string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if last == "" {
+				return nil, fmt.Errorf("invalid tag line: %q", line)
+			}
+			vals := tags[last]
+			vals[len(vals)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid tag line: %q", line)
+		}
+		last = strings.TrimSpace(line[:i])
+		tags[last] = append(tags[last], strings.TrimSpace(line[i+1:]))
+	}
+	return tags, scanner.Err()
+}
+
+func writeInfo(name string, info Info) error {
+	labels := make([]string, 0, len(info))
+	for l := range info {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	var b strings.Builder
+	for _, l := range labels {
+		for _, v := range info[l] {
+			fmt.Fprintf(&b, "%s: %s\n", l, v)
+		}
+	}
+	return os.WriteFile(name, []byte(b.String()), 0644)
+}
+
+// readManifests reads all manifest files with the prefix (manifest- or
+// tagmanifest-) in the root of fsys. Returned FileSets are keyed by
+// algorithm name.
+func readManifests(fsys fs.FS, prefix string) (map[string]delta.FileSet, error) {
+	names, err := fs.Glob(fsys, prefix+`*`+manifestExt)
+	if err != nil {
+		return nil, err
+	}
+	manifests := map[string]delta.FileSet{}
+	for _, name := range names {
+		alg := strings.TrimSuffix(strings.TrimPrefix(name, prefix), manifestExt)
+		if _, err := checksum.Lookup(alg); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		files, err := readManifest(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		manifests[alg] = files
+	}
+	return manifests, nil
+}
+
+// manifestAlgs returns constructors for the manifests' algorithms, keyed by
+// the names used in the manifest file names.
+func manifestAlgs(manifests map[string]delta.FileSet) map[string]func() hash.Hash {
+	algs := map[string]func() hash.Hash{}
+	for name := range manifests {
+		alg, _ := checksum.Lookup(name) // checked by readManifests
+		algs[name] = alg.New
+	}
+	return algs
+}
+
+func readManifest(fsys fs.FS, name string) (delta.FileSet, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	files := delta.FileSet{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		i := strings.IndexAny(line, " \t")
+		if i < 1 {
+			return nil, fmt.Errorf("%s: invalid line: %q", name, line)
+		}
+		sum := strings.ToLower(line[:i])
+		p, err := decodePath(strings.TrimLeft(line[i:], " \t"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		p = path.Clean(p)
+		if !fs.ValidPath(p) {
+			return nil, fmt.Errorf("%s: invalid path: %q", name, p)
+		}
+		if _, exists := files[p]; exists {
+			return nil, fmt.Errorf("%s: duplicate path: %q", name, p)
+		}
+		files[p] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func writeManifest(name string, files delta.FileSet) error {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", files[p], encodePath(p))
+	}
+	return os.WriteFile(name, []byte(b.String()), 0644)
+}
+
+// manifest paths percent-encode CR, LF and %
+var pathEncoder = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+func encodePath(p string) string {
+	return pathEncoder.Replace(p)
+}
+
+func decodePath(p string) (string, error) {
+	if !strings.Contains(p, "%") {
+		return p, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] != '%' {
+			b.WriteByte(p[i])
+			continue
+		}
+		if i+2 >= len(p) {
+			return "", fmt.Errorf("invalid percent-encoding in path: %q", p)
+		}
+		c, err := strconv.ParseUint(p[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid percent-encoding in path: %q", p)
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,85 @@
+package bagit_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/bagit"
+)
+
+// copyFixture copies the test fixture to a temporary directory
+func copyFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	src := os.DirFS("../test/fixture")
+	err := fs.WalkDir(src, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(p))
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		b, err := fs.ReadFile(src, p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, b, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCreateValidate(t *testing.T) {
+	dir := copyFixture(t)
+	info := bagit.Info{"Source-Organization": {"Test Org"}}
+	err := bagit.Create(dir, []string{checksum.MD5, checksum.SHA256}, info, checksum.WithGos(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"bagit.txt", "bag-info.txt", "manifest-md5.txt", "manifest-sha256.txt",
+		"tagmanifest-md5.txt", "tagmanifest-sha256.txt", "data/hello.csv",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	bagInfo, err := os.ReadFile(filepath.Join(dir, "bag-info.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bagInfo), "Payload-Oxum: 217434.4\n") {
+		t.Errorf("unexpected bag-info.txt: %s", bagInfo)
+	}
+	if err := bagit.Validate(os.DirFS(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	// modify, remove and add payload files
+	if err := os.WriteFile(filepath.Join(dir, "data/hello.csv"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "data/folder1/file.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data/new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = bagit.Validate(os.DirFS(dir))
+	var verr *bagit.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	// mismatch, missing, and extra for 2 algs + oxum
+	if len(verr.Errs) != 7 {
+		t.Errorf("expected 7 validation errors, got %d: %v", len(verr.Errs), verr)
+	}
+}
@@ -0,0 +1,163 @@
+package checksum
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/srerickson/checksum/internal/fileid"
+)
+
+// A Cache stores checksums from previous Walks and Pipes so that unchanged
+// files do not need to be read again. Entries are keyed by path and are only
+// used if the file's size, modification time and (where available) inode
+// number have not changed. A cached entry is only used if it includes all the
+// algorithms configured for the job; otherwise, the file is read and the
+// entry is updated. Because entries are keyed by path, a Cache should only be
+// used with a single fs.FS. Caches are safe for concurrent use.
+type Cache struct {
+	mx      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// cacheEntry is the cached state of a file
+type cacheEntry struct {
+	Size    int64             `json:"size"`
+	ModTime int64             `json:"mtime"` // unix nanoseconds
+	Inode   uint64            `json:"inode,omitempty"`
+	Sums    map[string][]byte `json:"sums"`
+	used    bool              // entry was used since load
+}
+
+// NewCache returns a new, empty Cache
+func NewCache() *Cache {
+	return &Cache{entries: make(map[string]*cacheEntry)}
+}
+
+// LoadCache reads a Cache previously saved with Save(). If the file does not
+// exist, an empty Cache is returned.
+func LoadCache(name string) (*Cache, error) {
+	c := NewCache()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return c, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.entries); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Save writes the Cache to the named file. The file is replaced atomically.
+func (c *Cache) Save(name string) error {
+	c.mx.Lock()
+	b, err := json.Marshal(c.entries)
+	c.mx.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+`.*`)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Invalidate removes all cached checksums for the named algorithm.
+func (c *Cache) Invalidate(alg string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	for _, e := range c.entries {
+		delete(e.Sums, alg)
+	}
+}
+
+// Prune removes entries that have not been used or updated since the Cache
+// was loaded. Calling Prune after a complete Walk removes entries for files
+// that no longer exist.
+func (c *Cache) Prune() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	for p, e := range c.entries {
+		if !e.used {
+			delete(c.entries, p)
+		}
+	}
+}
+
+// Len returns the number of entries in the Cache.
+func (c *Cache) Len() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return len(c.entries)
+}
+
+// get returns cached checksums for path if the entry matches info and
+// includes all algs.
+func (c *Cache) get(path string, info fs.FileInfo, algs []string) map[string][]byte {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	e := c.entries[path]
+	if e == nil || !e.matches(info) {
+		return nil
+	}
+	e.used = true
+	sums := make(map[string][]byte, len(algs))
+	for _, alg := range algs {
+		sum, ok := e.Sums[alg]
+		if !ok {
+			return nil
+		}
+		sums[alg] = append([]byte(nil), sum...)
+	}
+	return sums
+}
+
+// set adds sums to the entry for path.
+func (c *Cache) set(path string, info fs.FileInfo, sums map[string][]byte) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	e := c.entries[path]
+	if e == nil || !e.matches(info) {
+		e = &cacheEntry{
+			Size:    info.Size(),
+			ModTime: info.ModTime().UnixNano(),
+			Sums:    make(map[string][]byte),
+		}
+		if id, ok := fileid.FromInfo(info); ok {
+			e.Inode = id.Ino
+		}
+		c.entries[path] = e
+	}
+	if e.Sums == nil {
+		e.Sums = make(map[string][]byte)
+	}
+	e.used = true
+	for alg, sum := range sums {
+		e.Sums[alg] = append([]byte(nil), sum...)
+	}
+}
+
+func (e *cacheEntry) matches(info fs.FileInfo) bool {
+	if e.Size != info.Size() || e.ModTime != info.ModTime().UnixNano() {
+		return false
+	}
+	if id, ok := fileid.FromInfo(info); ok && e.Inode != 0 && e.Inode != id.Ino {
+		return false
+	}
+	return true
+}
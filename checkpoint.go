@@ -0,0 +1,167 @@
+package checksum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/srerickson/checksum/internal/fileid"
+)
+
+// checkpointInterval is how often the checkpoint journal is flushed to disk
+const checkpointInterval = 5 * time.Second
+
+// checkpoint is a journal of completed jobs used by Walk() to resume
+// interrupted walks. The journal is a file with one JSON object per line,
+// appended as jobs complete. A partial last line, from a process that was
+// killed while writing, is ignored and overwritten.
+type checkpoint struct {
+	file      *os.File
+	w         *bufio.Writer
+	done      map[string]*cacheEntry // completed jobs from previous walks
+	lastFlush time.Time
+}
+
+// checkpointEntry is a line in the checkpoint journal
+type checkpointEntry struct {
+	Path string `json:"path"`
+	cacheEntry
+}
+
+// openCheckpoint opens the named journal for writing. If resume is true, the
+// journal's existing entries are loaded and new entries are appended;
+// otherwise, the journal is truncated.
+func openCheckpoint(name string, resume bool) (*checkpoint, error) {
+	flag := os.O_RDWR | os.O_CREATE
+	if !resume {
+		flag |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(name, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	cp := &checkpoint{
+		file:      f,
+		done:      map[string]*cacheEntry{},
+		lastFlush: time.Now(),
+	}
+	if resume {
+		end, err := cp.load()
+		if err == nil {
+			err = f.Truncate(end)
+		}
+		if err == nil {
+			_, err = f.Seek(end, io.SeekStart)
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf(`reading checkpoint %s: %w`, name, err)
+		}
+	}
+	cp.w = bufio.NewWriter(f)
+	return cp, nil
+}
+
+// load reads the journal's entries. It returns the offset of the end of the
+// last complete line.
+func (cp *checkpoint) load() (int64, error) {
+	r := bufio.NewReader(cp.file)
+	var end int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return end, nil // ignore partial line
+		}
+		if err != nil {
+			return 0, err
+		}
+		end += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry checkpointEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return 0, err
+		}
+		e := entry.cacheEntry
+		cp.done[entry.Path] = &e
+	}
+}
+
+// has returns true if the journal has an entry for path
+func (cp *checkpoint) has(path string) bool {
+	return cp.done[path] != nil
+}
+
+// get returns the recorded checksums for path if the entry matches info and
+// includes all algs.
+func (cp *checkpoint) get(path string, info fs.FileInfo, algs []string) map[string][]byte {
+	e := cp.done[path]
+	if e == nil || !e.matches(info) {
+		return nil
+	}
+	sums := make(map[string][]byte, len(algs))
+	for _, alg := range algs {
+		sum, ok := e.Sums[alg]
+		if !ok {
+			return nil
+		}
+		sums[alg] = sum
+	}
+	return sums
+}
+
+// record appends the job's result to the journal. The journal is flushed if
+// checkpointInterval has passed since the last flush.
+func (cp *checkpoint) record(j Job) error {
+	info := j.Info()
+	if info == nil {
+		return nil
+	}
+	entry := checkpointEntry{
+		Path: j.Path(),
+		cacheEntry: cacheEntry{
+			Size:    info.Size(),
+			ModTime: info.ModTime().UnixNano(),
+			Sums:    j.sums,
+		},
+	}
+	if id, ok := fileid.FromInfo(info); ok {
+		entry.Inode = id.Ino
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := cp.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if time.Since(cp.lastFlush) >= checkpointInterval {
+		return cp.flush()
+	}
+	return nil
+}
+
+// flush writes buffered entries and syncs the journal to disk
+func (cp *checkpoint) flush() error {
+	cp.lastFlush = time.Now()
+	if err := cp.w.Flush(); err != nil {
+		return err
+	}
+	return cp.file.Sync()
+}
+
+// close flushes and closes the journal
+func (cp *checkpoint) close() error {
+	err := cp.flush()
+	if closeErr := cp.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -1,14 +1,28 @@
 package checksum_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/delta"
 )
 
 var testMD5Sums = map[string]string{
@@ -222,3 +236,929 @@ func ExampleWalk() {
 	}
 	// Output: a0556088c3b6a78b2d8ef7b318cfca54589f68c0
 }
+
+func TestVerify(t *testing.T) {
+	dir := os.DirFS(`test/fixture`)
+	manifest := delta.FileSet{
+		"hello.csv":                 "9d02fa6e9dd9f38327f7b213daa28be6",
+		"folder1/file.txt":          "D41D8CD98F00B204E9800998ECF8427E",
+		"folder1/folder2/file2.txt": "e8c078f0e4ad79b16fcb618a3790c2df", // wrong
+		"folder1/folder2/gone.txt":  "d41d8cd98f00b204e9800998ecf8427e", // missing
+	}
+	results, err := checksum.Verify(dir, manifest, checksum.WithMD5(), checksum.WithExtraFiles())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct {
+		path   string
+		status checksum.VerifyStatus
+	}{
+		{"folder1/file.txt", checksum.VerifyOK},
+		{"folder1/folder2/file2.txt", checksum.VerifyFailed},
+		{"folder1/folder2/gone.txt", checksum.VerifyMissing},
+		{"folder1/folder2/sculpture-stone-face-head-888027.jpg", checksum.VerifyExtra},
+		{"hello.csv", checksum.VerifyOK},
+	}
+	if len(results) != len(expect) {
+		t.Fatalf("expected %d results, got %d", len(expect), len(results))
+	}
+	for i, e := range expect {
+		if results[i].Path != e.path || results[i].Status != e.status {
+			t.Errorf("expected %s %s, got %s %s", e.path, e.status, results[i].Path, results[i].Status)
+		}
+	}
+	if _, err := checksum.Verify(dir, manifest, checksum.WithMD5(), checksum.WithSHA1()); err == nil {
+		t.Error("expected an error with multiple algorithms")
+	}
+}
+
+func TestJobInfo(t *testing.T) {
+	sizes := map[string]int64{}
+	each := func(j checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		if j.Info() == nil {
+			return fmt.Errorf("missing info for %s", j.Path())
+		}
+		sizes[j.Path()] = j.Info().Size()
+		return nil
+	}
+	err := checksum.Walk(os.DirFS("test/fixture"), ".", each, checksum.WithMD5())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizes["hello.csv"] != 15 || sizes["folder1/file.txt"] != 0 {
+		t.Errorf("unexpected sizes: %v", sizes)
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	// walk returns the paths of cached jobs
+	walk := func(opts ...func(*checksum.Config)) []string {
+		t.Helper()
+		cache, err := checksum.LoadCache(cacheFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cached []string
+		each := func(j checksum.Job, err error) error {
+			if err != nil {
+				return err
+			}
+			if j.Cached() {
+				cached = append(cached, j.Path())
+			}
+			if _, err := j.Sum(checksum.MD5); err != nil {
+				return err
+			}
+			return nil
+		}
+		opts = append(opts, checksum.WithCache(cache))
+		if err := checksum.Walk(os.DirFS(dir), ".", each, opts...); err != nil {
+			t.Fatal(err)
+		}
+		cache.Prune()
+		if err := cache.Save(cacheFile); err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(cached)
+		return cached
+	}
+	if cached := walk(checksum.WithMD5()); len(cached) != 0 {
+		t.Errorf("expected no cached results on first walk, got %v", cached)
+	}
+	if cached := walk(checksum.WithMD5()); len(cached) != 3 {
+		t.Errorf("expected 3 cached results, got %v", cached)
+	}
+	// sha1 isn't cached yet
+	if cached := walk(checksum.WithMD5(), checksum.WithSHA1()); len(cached) != 0 {
+		t.Errorf("expected no cached results with new algorithm, got %v", cached)
+	}
+	// change a file
+	later := time.Now().Add(time.Hour)
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, "b.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	cached := walk(checksum.WithMD5(), checksum.WithSHA1())
+	if len(cached) != 1 || cached[0] != "a.txt" {
+		t.Errorf("expected only a.txt to be cached, got %v", cached)
+	}
+	cache, err := checksum.LoadCache(cacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 cache entries after prune, got %d", cache.Len())
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var mx sync.Mutex
+	var last checksum.Stats
+	var calls int
+	progress := func(s checksum.Stats) {
+		mx.Lock()
+		defer mx.Unlock()
+		last = s
+		calls++
+	}
+	each := func(j checksum.Job, err error) error { return err }
+	err := checksum.Walk(os.DirFS("test/fixture"), ".", each,
+		checksum.WithMD5(),
+		checksum.WithProgress(time.Millisecond, progress))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	if calls == 0 {
+		t.Fatal("progress function not called")
+	}
+	if last.FilesQueued != 4 || last.FilesDone != 4 {
+		t.Errorf("expected 4 files queued and done, got %d, %d", last.FilesQueued, last.FilesDone)
+	}
+	if last.BytesHashed != 217434 || last.BytesQueued != 217434 || last.BytesRemaining() != 0 {
+		t.Errorf("unexpected byte counts: %+v", last)
+	}
+
+	// Stats() from a Pipe
+	pipe, err := checksum.NewPipe(os.DirFS("test/fixture"), checksum.WithMD5())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer pipe.Close()
+		pipe.Add("hello.csv")
+	}()
+	for range pipe.Out() {
+	}
+	if s := pipe.Stats(); s.FilesDone != 1 || s.BytesHashed != 15 || s.BytesQueued != 15 {
+		t.Errorf("unexpected pipe stats: %+v", s)
+	}
+
+	// the current rate is weighted toward recent throughput: it decays
+	// while hashing is stalled, but more slowly than the average
+	pipe, err = checksum.NewPipe(os.DirFS("."), checksum.WithMD5())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, w := io.Pipe()
+	go func() {
+		defer pipe.Close()
+		pipe.AddReader("stalled", r)
+	}()
+	if _, err := w.Write(make([]byte, 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+	for pipe.Stats().BytesHashed < 1<<20 {
+		time.Sleep(time.Millisecond)
+	}
+	s1 := pipe.Stats()
+	time.Sleep(500 * time.Millisecond)
+	s2 := pipe.Stats()
+	w.Close()
+	for range pipe.Out() {
+	}
+	if s1.Rate() <= 0 || s2.Rate() >= s1.Rate() || s2.Rate() <= s2.AverageRate() {
+		t.Errorf("unexpected rates: current %.0f then %.0f, average %.0f", s1.Rate(), s2.Rate(), s2.AverageRate())
+	}
+}
+
+func TestSplitTreeHash(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 3*1024*1024+512*1024) // 3.5 MiB
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "big"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// expected tree hash
+	var leaves [][]byte
+	for off := 0; off < len(data); off += 1024 * 1024 {
+		end := off + 1024*1024
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha256.Sum256(data[off:end])
+		leaves = append(leaves, sum[:])
+	}
+	pair := func(a, b []byte) []byte {
+		sum := sha256.Sum256(append(append([]byte{}, a...), b...))
+		return sum[:]
+	}
+	expected := hex.EncodeToString(pair(pair(leaves[0], leaves[1]), pair(leaves[2], leaves[3])))
+
+	for _, split := range []int64{0, 1024} {
+		var got string
+		each := func(j checksum.Job, err error) error {
+			if err != nil {
+				return err
+			}
+			got, err = j.SumString(checksum.SHA256Tree)
+			return err
+		}
+		err := checksum.Walk(os.DirFS(dir), ".", each,
+			checksum.WithGos(4),
+			checksum.WithSHA256Tree(),
+			checksum.WithSplitSize(split))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("split size %d: expected %s, got %s", split, expected, got)
+		}
+	}
+
+	// concurrent reads are limited by WithGos()
+	var active, maxActive int64
+	pipe, err := checksum.NewPipe(os.DirFS(dir),
+		checksum.WithGos(3),
+		checksum.WithSHA256Tree(),
+		checksum.WithSplitSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer pipe.Close()
+		for i := 0; i < 6; i++ {
+			r := &activeReader{SectionReader: io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))),
+				active: &active, max: &maxActive}
+			pipe.AddReader(fmt.Sprint(i), r)
+		}
+	}()
+	for j := range pipe.Out() {
+		got, err := j.SumString(checksum.SHA256Tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("reader %s: expected %s, got %s", j.Path(), expected, got)
+		}
+	}
+	if maxActive > 3 {
+		t.Errorf("expected at most 3 concurrent reads, got %d", maxActive)
+	}
+}
+
+// activeReader tracks the maximum number of concurrent calls to ReadAt
+type activeReader struct {
+	*io.SectionReader
+	active, max *int64
+}
+
+func (r *activeReader) ReadAt(p []byte, off int64) (int, error) {
+	n := atomic.AddInt64(r.active, 1)
+	defer atomic.AddInt64(r.active, -1)
+	for {
+		m := atomic.LoadInt64(r.max)
+		if n <= m || atomic.CompareAndSwapInt64(r.max, m, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond) // give other readers a chance to overlap
+	return r.SectionReader.ReadAt(p, off)
+}
+
+func TestAddReader(t *testing.T) {
+	pipe, err := checksum.NewPipe(os.DirFS("test/fixture"), checksum.WithMD5())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer pipe.Close()
+		pipe.AddReader("stream", bytes.NewBufferString("hello"))
+		pipe.AddReader("section", io.NewSectionReader(strings.NewReader("hello"), 0, 5))
+		pipe.Add("hello.csv")
+	}()
+	got := map[string]string{}
+	for j := range pipe.Out() {
+		if err := j.Err(); err != nil {
+			t.Fatal(err)
+		}
+		got[j.Path()], _ = j.SumString(checksum.MD5)
+	}
+	helloMD5 := "5d41402abc4b2a76b9719d911017c592"
+	if got["stream"] != helloMD5 || got["section"] != helloMD5 {
+		t.Errorf("unexpected reader checksums: %v", got)
+	}
+	if got["hello.csv"] != "9d02fa6e9dd9f38327f7b213daa28be6" {
+		t.Errorf("unexpected file checksum: %v", got)
+	}
+}
+
+func TestWalkOrdered(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 50; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("d%d", i%3))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		// larger files first so they tend to complete later
+		data := bytes.Repeat([]byte{byte(i)}, (50-i)*10000)
+		if err := os.WriteFile(filepath.Join(sub, fmt.Sprintf("f%02d", i)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var expected []string
+	fs.WalkDir(os.DirFS(dir), ".", func(p string, d fs.DirEntry, err error) error {
+		if d.Type().IsRegular() {
+			expected = append(expected, p)
+		}
+		return err
+	})
+	var got []string
+	each := func(j checksum.Job, err error) error {
+		got = append(got, j.Path())
+		return err
+	}
+	err := checksum.Walk(os.DirFS(dir), ".", each,
+		checksum.WithGos(8),
+		checksum.WithSHA512(),
+		checksum.WithOrdered(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("results not in walk order:\n%v\n%v", got, expected)
+	}
+}
+
+func TestWalkFilters(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":        "*.log\n/build/\n!keep.log\n",
+		"a.txt":             "a",
+		"a.log":             "a",
+		"keep.log":          "keep",
+		"build/out.bin":     "out",
+		".git/HEAD":         "ref",
+		"sub/b.txt":         "b",
+		"sub/b.tmp":         "b",
+		"sub/.gitignore":    "!*.log\n",
+		"sub/c.log":         "c",
+		"sub/build/out.txt": "out",
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	walk := func(opts ...func(*checksum.Config)) string {
+		t.Helper()
+		var got []string
+		each := func(j checksum.Job, err error) error {
+			got = append(got, j.Path())
+			return err
+		}
+		opts = append(opts, checksum.WithMD5())
+		if err := checksum.Walk(os.DirFS(dir), ".", each, opts...); err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(got)
+		return strings.Join(got, ",")
+	}
+	got := walk(checksum.WithExclude(".git/", "*.tmp"), checksum.WithIgnoreFiles(".gitignore"))
+	expect := ".gitignore,a.txt,keep.log,sub/.gitignore,sub/b.txt,sub/build/out.txt,sub/c.log"
+	if got != expect {
+		t.Errorf("expected %s, got %s", expect, got)
+	}
+	got = walk(checksum.WithInclude("*.txt"), checksum.WithExclude("sub/build/"))
+	expect = "a.txt,sub/b.txt"
+	if got != expect {
+		t.Errorf("expected %s, got %s", expect, got)
+	}
+	got = walk(checksum.WithInclude("**/build/**", "/*.[!t]??"), checksum.WithExclude(".git/"))
+	expect = "a.log,build/out.bin,keep.log,sub/build/out.txt"
+	if got != expect {
+		t.Errorf("expected %s, got %s", expect, got)
+	}
+	err := checksum.Walk(os.DirFS(dir), ".", func(checksum.Job, error) error { return nil },
+		checksum.WithMD5(), checksum.WithExclude("[oops"))
+	if err == nil {
+		t.Error("expected an error for invalid pattern")
+	}
+}
+
+func TestWalkSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a", "file.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"a/link.txt": "file.txt",
+		"a/loop":     "..",
+		"b":          "a",
+		"dangling":   "nothing",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+	walk := func(mode checksum.SymlinkMode) map[string]string {
+		t.Helper()
+		got := map[string]string{}
+		each := func(j checksum.Job, err error) error {
+			if err != nil {
+				return err
+			}
+			if target, ok := j.Symlink(); ok {
+				got[j.Path()] = "-> " + target
+				return nil
+			}
+			got[j.Path()], err = j.SumString(checksum.MD5)
+			return err
+		}
+		err := checksum.Walk(os.DirFS(dir), ".", each,
+			checksum.WithMD5(),
+			checksum.WithSymlinks(mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	helloMD5 := "5d41402abc4b2a76b9719d911017c592"
+	got := walk(checksum.SymlinkFollow)
+	expect := map[string]string{
+		"a/file.txt": helloMD5,
+		"a/link.txt": helloMD5,
+		"b/file.txt": helloMD5,
+		"b/link.txt": helloMD5,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("SymlinkFollow: expected %v, got %v", expect, got)
+	}
+	got = walk(checksum.SymlinkReport)
+	expect = map[string]string{
+		"a/file.txt": helloMD5,
+		"a/link.txt": "-> file.txt",
+		"a/loop":     "-> ..",
+		"b":          "-> a",
+		"dangling":   "-> nothing",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("SymlinkReport: expected %v, got %v", expect, got)
+	}
+	got = walk(checksum.SymlinkSkip)
+	if len(got) != 1 {
+		t.Errorf("SymlinkSkip: expected only a/file.txt, got %v", got)
+	}
+}
+
+func TestWalkOrderedSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "c", "e"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, target := range map[string]string{"b": "a", "d": "c"} {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+	var got []string
+	each := func(j checksum.Job, err error) error {
+		got = append(got, j.Path())
+		return err
+	}
+	err := checksum.Walk(os.DirFS(dir), ".", each,
+		checksum.WithMD5(),
+		checksum.WithOrdered(2),
+		checksum.WithSymlinks(checksum.SymlinkReport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "a,b,c,d,e" {
+		t.Errorf("expected a,b,c,d,e in order, got %v", got)
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	expect := map[string]string{
+		checksum.SHA3_256:   "3338be694f50c5f338814986cdf0686453a888b84f424d792af4b9202398f392",
+		checksum.SHA3_512:   "75d527c368f2efe848ecf6b073a36767800805e9eef2b1857d5f984f036eb6df891d75f72d9b154518c1cd58835286d1da9a38deba3de98b5a53e5ed78a84976",
+		checksum.BLAKE2B512: "e4cfa39a3d37be31c59609e807970799caa68a19bfaa15135f165085e01d41a65ba1e1b146aeb6bd0092b49eac214c103ccfa3a365954bbbe52f74a2b3620c94",
+		checksum.BLAKE3:     "ea8f163db38682925e4491c5e58d4bb3506ef8c14eb78a86e908c5624a67200f",
+		checksum.XXH3:       "9555e8555c62dcfd",
+	}
+	pipe, err := checksum.NewPipe(os.DirFS("."),
+		checksum.WithSHA3_256(),
+		checksum.WithSHA3_512(),
+		checksum.WithBLAKE2b512(),
+		checksum.WithBLAKE3(),
+		checksum.WithXXH3())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer pipe.Close()
+		pipe.AddReader("hello", strings.NewReader("hello"))
+	}()
+	for j := range pipe.Out() {
+		if err := j.Err(); err != nil {
+			t.Fatal(err)
+		}
+		for alg, want := range expect {
+			got, err := j.SumString(alg)
+			if err != nil {
+				t.Error(err)
+			}
+			if got != want {
+				t.Errorf("%s: expected %s, got %s", alg, want, got)
+			}
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	for _, name := range []string{"SHA-256", "sha2-256", "sha_256", "sha256"} {
+		alg, err := checksum.Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alg.Name != checksum.SHA256 || alg.Size != 32 {
+			t.Errorf("Lookup(%q): unexpected result: %s, %d", name, alg.Name, alg.Size)
+		}
+		if size := alg.New().Size(); size != alg.Size {
+			t.Errorf("Lookup(%q): hash size is %d, not %d", name, size, alg.Size)
+		}
+	}
+	if _, err := checksum.Lookup("crc32"); !errors.Is(err, checksum.ErrUnknownAlg) {
+		t.Errorf("expected ErrUnknownAlg, got %v", err)
+	}
+	names := checksum.Algorithms()
+	if !sort.StringsAreSorted(names) {
+		t.Error("Algorithms() isn't sorted")
+	}
+	for _, name := range names {
+		if _, err := checksum.Lookup(name); err != nil {
+			t.Error(err)
+		}
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected Register to panic for duplicate alias")
+			}
+		}()
+		checksum.Register("my-sha256", []string{"SHA-256"}, sha256.New, sha256.Size)
+	}()
+	if _, err := checksum.Lookup("my-sha256"); err == nil {
+		t.Error("failed Register shouldn't add the algorithm")
+	}
+}
+
+func TestBufferSize(t *testing.T) {
+	// one go routine reuses the same buffer and hashes for every file
+	for _, opts := range [][]func(*checksum.Config){
+		{checksum.WithMD5()},
+		{checksum.WithMD5(), checksum.WithSHA1()},
+	} {
+		opts = append(opts, checksum.WithGos(1), checksum.WithBufferSize(7))
+		got := map[string]string{}
+		err := checksum.Walk(os.DirFS("."), "test/fixture", func(j checksum.Job, err error) error {
+			if err != nil {
+				return err
+			}
+			got[j.Path()], err = j.SumString(checksum.MD5)
+			return err
+		}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for p, want := range testMD5Sums {
+			if got[p] != want {
+				t.Errorf("%s: expected %s, got %s", p, want, got[p])
+			}
+		}
+	}
+	// hashes aren't reused for jobs with different constructors for a name
+	pipe, err := checksum.NewPipe(os.DirFS("."), checksum.WithGos(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"a", "b", "a"}
+	go func() {
+		defer pipe.Close()
+		for _, key := range keys {
+			newHash := func() hash.Hash { return hmac.New(sha256.New, []byte(key)) }
+			if err := pipe.Add("test/fixture/hello.csv", checksum.WithAlg("hmac", newHash)); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	var sums []string
+	for j := range pipe.Out() {
+		sum, err := j.SumString("hmac")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sums = append(sums, sum)
+	}
+	if len(sums) != 3 || sums[0] == sums[1] || sums[0] != sums[2] {
+		t.Errorf("unexpected sums for different keys: %v", sums)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 150*1024)
+	throttle := checksum.NewThrottle(300*1024, 0)
+	hashReader := func() error {
+		pipe, err := checksum.NewPipe(nil, checksum.WithMD5(), checksum.WithThrottle(throttle))
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer pipe.Close()
+			pipe.AddReader("data", bytes.NewReader(data))
+		}()
+		for j := range pipe.Out() {
+			err = j.Err()
+		}
+		return err
+	}
+	start := time.Now()
+	if err := hashReader(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("150KiB at 300KiB/s took %s", elapsed)
+	}
+
+	// limits can be changed while jobs are waiting
+	throttle.SetBytesPerSec(1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		throttle.SetBytesPerSec(0)
+	}()
+	start = time.Now()
+	if err := hashReader(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("removing the limit didn't take effect: took %s", elapsed)
+	}
+	if b, o := throttle.Limits(); b != 0 || o != 0 {
+		t.Errorf("unexpected limits: %d, %d", b, o)
+	}
+
+	// file opens
+	throttle.SetOpensPerSec(20)
+	start = time.Now()
+	err := checksum.Walk(os.DirFS("."), "test/fixture", func(j checksum.Job, err error) error {
+		return err
+	}, checksum.WithMD5(), checksum.WithThrottle(throttle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("4 files at 20 opens/s took %s", elapsed)
+	}
+
+	// canceled context
+	throttle.SetOpensPerSec(1)
+	throttle.SetBytesPerSec(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = checksum.Walk(os.DirFS("."), "test/fixture", func(j checksum.Job, err error) error {
+		return err
+	}, checksum.WithMD5(), checksum.WithThrottle(throttle), checksum.WithCtx(ctx))
+	var walkErr *checksum.WalkErr
+	if !errors.As(err, &walkErr) || !errors.Is(walkErr.JobFuncErr, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "journal")
+	fsys := os.DirFS("test/fixture")
+	errStop := errors.New("stop")
+	// interrupted walk
+	var count int
+	err := checksum.Walk(fsys, ".", func(j checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		if count++; count == 3 {
+			return errStop
+		}
+		return nil
+	}, checksum.WithMD5(), checksum.WithGos(1), checksum.WithCheckpoint(journal, false))
+	var walkErr *checksum.WalkErr
+	if !errors.As(err, &walkErr) || walkErr.JobFuncErr != errStop {
+		t.Fatalf("expected errStop, got %v", err)
+	}
+	// simulate a partial write
+	f, err := os.OpenFile(journal, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"path":"hel`)
+	f.Close()
+	// resume
+	var paths []string
+	var resumed int
+	err = checksum.Walk(fsys, ".", func(j checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, j.Path())
+		if j.Resumed() {
+			resumed++
+		}
+		got, err := j.SumString(checksum.MD5)
+		if err != nil {
+			return err
+		}
+		if want := testMD5Sums["test/fixture/"+j.Path()]; got != want {
+			t.Errorf("%s: expected %s, got %s", j.Path(), want, got)
+		}
+		return nil
+	}, checksum.WithMD5(), checksum.WithOrdered(0), checksum.WithCheckpoint(journal, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed != 2 {
+		t.Errorf("expected 2 resumed jobs, got %d", resumed)
+	}
+	if len(paths) != len(testMD5Sums) || !sort.StringsAreSorted(paths) {
+		t.Errorf("unexpected paths from resumed walk: %v", paths)
+	}
+	// all files are in the journal now
+	resumed = 0
+	err = checksum.Walk(fsys, ".", func(j checksum.Job, err error) error {
+		if j.Resumed() {
+			resumed++
+		}
+		return err
+	}, checksum.WithMD5(), checksum.WithCheckpoint(journal, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed != len(testMD5Sums) {
+		t.Errorf("expected %d resumed jobs, got %d", len(testMD5Sums), resumed)
+	}
+	// jobs with algorithms missing from the journal are not resumed
+	err = checksum.Walk(fsys, ".", func(j checksum.Job, err error) error {
+		if j.Resumed() {
+			t.Errorf("%s: unexpected resumed job", j.Path())
+		}
+		return err
+	}, checksum.WithMD5(), checksum.WithSHA1(), checksum.WithCheckpoint(journal, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	pipe, err := checksum.NewPipe(nil, checksum.WithSHA256(), checksum.WithSHA384(), checksum.WithBLAKE2b512(), checksum.WithMD5())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer pipe.Close()
+		pipe.AddReader("hello", strings.NewReader("hello"))
+	}()
+	job := <-pipe.Out()
+	if err := job.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct {
+		alg string
+		enc checksum.Encoding
+		val string
+	}{
+		{checksum.SHA256, checksum.Hex, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{checksum.SHA256, checksum.Base64, "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="},
+		{checksum.SHA256, checksum.Base64URL, "LPJNul-wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ"},
+		{checksum.SHA256, checksum.Base32, "FTZE3OS7WCRQ4JXIHMVMLOPCTYNRMHS4D6TUEXTTAQZWFE4LTASA===="},
+		{checksum.SHA256, checksum.Multihash, "zQmRN6wdp1S2A5EtjW9A3M1vKSBuQQGcgvuhoMUoEz4iiT5"},
+		{checksum.SHA384, checksum.SRI, "sha384-WeF0h3dEjGnea4ANejO7+5/xtGPkQ1TDVTvNucZm+pASWjx5+QOXvfX2oT3oKGhP"},
+	}
+	for _, e := range expect {
+		got, err := job.SumEncoded(e.alg, e.enc)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", e.alg, e.enc, err)
+		}
+		if got != e.val {
+			t.Errorf("%s/%s: expected %s, got %s", e.alg, e.enc, e.val, got)
+		}
+		alg, sum, err := e.enc.Decode(got)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", e.alg, e.enc, err)
+		}
+		want, _ := job.Sum(e.alg)
+		if !bytes.Equal(sum, want) {
+			t.Errorf("%s/%s: decoded digest doesn't match", e.alg, e.enc)
+		}
+		if (e.enc == checksum.Multihash || e.enc == checksum.SRI) && alg != e.alg {
+			t.Errorf("%s/%s: decoded algorithm is %q", e.alg, e.enc, alg)
+		}
+	}
+	// multihash with a multi-byte code, in other multibases
+	mh, err := job.SumEncoded(checksum.BLAKE2B512, checksum.Multihash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alg, _, err := checksum.Multihash.Decode(mh); err != nil || alg != checksum.BLAKE2B512 {
+		t.Errorf("unexpected result decoding %s: %s, %v", mh, alg, err)
+	}
+	for _, s := range []string{
+		"QmRN6wdp1S2A5EtjW9A3M1vKSBuQQGcgvuhoMUoEz4iiT5",
+		"f12202cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"uEiAs8k26X7CjDiboOyrFueKeGxYeXB-nQl5zBDNik4uYJA",
+	} {
+		if alg, _, err := checksum.Multihash.Decode(s); err != nil || alg != checksum.SHA256 {
+			t.Errorf("unexpected result decoding %s: %s, %v", s, alg, err)
+		}
+	}
+	// lenient decoding
+	if _, sum, err := checksum.Base32.Decode("ftze3os7wcrq4jxihmvmlopctynrmhs4d6tuexttaqzwfe4ltasa"); err != nil || len(sum) != 32 {
+		t.Errorf("unexpected result decoding unpadded base32: %v", err)
+	}
+	// algorithm names with dashes
+	if alg, sum, err := checksum.SRI.Decode("SHA-384-WeF0h3dEjGnea4ANejO7+5/xtGPkQ1TDVTvNucZm+pASWjx5+QOXvfX2oT3oKGhP"); err != nil || alg != checksum.SHA384 || len(sum) != 48 {
+		t.Errorf("unexpected result decoding SRI with dashed name: %s, %v", alg, err)
+	}
+	// errors
+	if _, err := job.SumEncoded(checksum.MD5, checksum.SRI); err == nil {
+		t.Error("expected an error for md5 SRI")
+	}
+	if _, _, err := checksum.SRI.Decode("sha256-LPJN"); !errors.Is(err, checksum.ErrInvalidDigest) {
+		t.Errorf("expected ErrInvalidDigest, got %v", err)
+	}
+	if _, _, err := checksum.Hex.Decode("xyz"); !errors.Is(err, checksum.ErrInvalidDigest) {
+		t.Errorf("expected ErrInvalidDigest, got %v", err)
+	}
+	if enc, err := checksum.ParseEncoding("SRI"); err != nil || enc != checksum.SRI {
+		t.Errorf("ParseEncoding: unexpected result: %s, %v", enc, err)
+	}
+}
+
+// benchFS returns an in-memory FS with n files of the given size
+func benchFS(n int, size int) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	data := bytes.Repeat([]byte("0123456789abcdef"), size/16+1)[:size]
+	for i := 0; i < n; i++ {
+		fsys[fmt.Sprintf("dir%02d/file%04d", i%16, i)] = &fstest.MapFile{Data: data}
+	}
+	return fsys
+}
+
+func benchmarkWalk(b *testing.B, fsys fs.FS, opts ...func(*checksum.Config)) {
+	b.ReportAllocs()
+	var bytes int64
+	for _, f := range fsys.(fstest.MapFS) {
+		bytes += int64(len(f.Data))
+	}
+	b.SetBytes(bytes)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := checksum.Walk(fsys, ".", func(j checksum.Job, err error) error {
+			return err
+		}, opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWalkSmallFiles(b *testing.B) {
+	fsys := benchFS(1000, 4*1024)
+	b.Run("sha256", func(b *testing.B) {
+		benchmarkWalk(b, fsys, checksum.WithSHA256())
+	})
+	b.Run("md5+sha256", func(b *testing.B) {
+		benchmarkWalk(b, fsys, checksum.WithMD5(), checksum.WithSHA256())
+	})
+}
+
+func BenchmarkWalkLargeFiles(b *testing.B) {
+	fsys := benchFS(8, 4*1024*1024)
+	b.Run("sha256", func(b *testing.B) {
+		benchmarkWalk(b, fsys, checksum.WithSHA256())
+	})
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/delta"
+	"github.com/srerickson/checksum/dupes"
+	"github.com/srerickson/checksum/manifest"
+)
+
+// runHash prints checksums for all files in a directory
+func runHash(args []string, stdout, stderr io.Writer) error {
+	fset := flag.NewFlagSet("hash", flag.ExitOnError)
+	fset.SetOutput(stderr)
+	var common commonFlags
+	common.register(fset)
+	format := fset.String("format", "gnu", "output format: gnu (sha256sum style), bsd (tagged), json, or jsonl (JSON Lines); all but gnu support multiple algorithms")
+	encName := fset.String("encoding", "hex", "digest encoding for bsd format: hex, base64, base64url, base32, multihash, or sri")
+	fset.Parse(args)
+	if fset.NArg() != 1 {
+		return fmt.Errorf("usage: checksum hash [flags] DIR")
+	}
+	enc, err := checksum.ParseEncoding(*encName)
+	if err != nil {
+		return err
+	}
+	if enc != checksum.Hex && *format != "bsd" {
+		return fmt.Errorf("--encoding requires --format bsd")
+	}
+	opts, err := common.options(checksum.SHA256)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(stdout)
+	var each checksum.JobFunc
+	var closeJSON func() error
+	switch *format {
+	case "gnu":
+		if len(common.algs) != 1 {
+			return fmt.Errorf("gnu format requires exactly one algorithm")
+		}
+		each = manifest.NewWriter(out, common.algs[0]).JobFunc()
+	case "bsd":
+		each = func(j checksum.Job, err error) error {
+			if err != nil {
+				return err
+			}
+			for _, alg := range common.algs {
+				sum, err := j.SumEncoded(alg, enc)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "%s (%s) = %s\n", strings.ToUpper(alg), j.Path(), sum)
+			}
+			return nil
+		}
+	case "json", "jsonl":
+		w := manifest.NewJSONLinesWriter(out)
+		if *format == "json" {
+			w = manifest.NewJSONWriter(out)
+		}
+		closeJSON = w.Close
+		each = w.JobFunc()
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+	// stable output for manifests
+	opts = append(opts, checksum.WithOrdered(0))
+	err = checksum.Walk(os.DirFS(fset.Arg(0)), ".", each, opts...)
+	if closeJSON != nil {
+		if closeErr := closeJSON(); err == nil {
+			err = closeErr
+		}
+	}
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// runVerify checks files against a manifest
+func runVerify(args []string, stdout, stderr io.Writer) error {
+	fset := flag.NewFlagSet("verify", flag.ExitOnError)
+	fset.SetOutput(stderr)
+	var common commonFlags
+	common.register(fset)
+	extra := fset.Bool("extra", false, "report files that are not in the manifest")
+	quiet := fset.Bool("quiet", false, "don't print OK for each successfully verified file")
+	fset.Parse(args)
+	if fset.NArg() < 1 || fset.NArg() > 2 {
+		return fmt.Errorf("usage: checksum verify [flags] MANIFEST [DIR]")
+	}
+	dir := "."
+	if fset.NArg() == 2 {
+		dir = fset.Arg(1)
+	}
+	if len(common.algs) > 1 {
+		return fmt.Errorf("verify uses one algorithm, got %d", len(common.algs))
+	}
+	var alg string
+	if len(common.algs) == 1 {
+		a, err := checksum.Lookup(common.algs[0])
+		if err != nil {
+			return err
+		}
+		alg = a.Name
+	}
+	files, alg, err := manifest.ReadFile(fset.Arg(0), alg)
+	if err != nil {
+		return err
+	}
+	common.algs = listFlag{alg}
+	opts, err := common.options("")
+	if err != nil {
+		return err
+	}
+	if *extra {
+		opts = append(opts, checksum.WithExtraFiles())
+	}
+	results, err := checksum.Verify(os.DirFS(dir), files, opts...)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(stdout)
+	var failed int
+	for _, r := range results {
+		if r.Status != checksum.VerifyOK {
+			failed++
+		} else if *quiet {
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s\n", r.Path, r.Status)
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		fmt.Fprintf(stderr, "checksum: %d of %d files did not verify\n", failed, len(results))
+		return errFailed
+	}
+	return nil
+}
+
+// runDiff compares two manifests
+func runDiff(args []string, stdout, stderr io.Writer) error {
+	fset := flag.NewFlagSet("diff", flag.ExitOnError)
+	fset.SetOutput(stderr)
+	var common commonFlags
+	common.registerWalk(fset)
+	asJSON := fset.Bool("json", false, "print the changes as JSON")
+	fset.Parse(args)
+	if fset.NArg() != 2 {
+		return fmt.Errorf("usage: checksum diff [flags] OLD_MANIFEST (NEW_MANIFEST | DIR)")
+	}
+	var d *delta.Delta
+	if info, err := os.Stat(fset.Arg(1)); err == nil && info.IsDir() {
+		// the algorithm is chosen from the manifest
+		d, err = manifest.Diff(os.DirFS(fset.Arg(1)), ".", fset.Arg(0), common.walkOptions()...)
+		if err != nil {
+			return err
+		}
+	} else {
+		v1, alg, err := manifest.ReadFile(fset.Arg(0), "")
+		if err != nil {
+			return err
+		}
+		// the second manifest must have the same algorithm
+		v2, _, err := manifest.ReadFile(fset.Arg(1), alg)
+		if err != nil {
+			return err
+		}
+		d = delta.New(v1, v2)
+	}
+	report := d.Report()
+	if *asJSON {
+		return report.WriteJSON(stdout)
+	}
+	return report.WriteText(stdout)
+}
+
+// runDupes lists identical files
+func runDupes(args []string, stdout, stderr io.Writer) error {
+	fset := flag.NewFlagSet("dupes", flag.ExitOnError)
+	fset.SetOutput(stderr)
+	var common commonFlags
+	common.register(fset)
+	partial := fset.Int64("partial", dupes.DefaultPartialSize, "bytes from the start and end of files to compare before full checksums")
+	link := fset.String("link", "", "replace duplicates with links: hardlink, reflink, or auto (reflink if supported)")
+	undoLog := fset.String("undo-log", "", "with --link (required), append a log of replaced files to this file")
+	undo := fset.String("undo", "", "restore files replaced by --link, using the undo log")
+	fset.Parse(args)
+	if fset.NArg() != 1 {
+		return fmt.Errorf("usage: checksum dupes [flags] DIR")
+	}
+	dir := fset.Arg(0)
+	if *undo != "" {
+		return undoLinks(dir, *undo, stdout)
+	}
+	var mode dupes.LinkMode
+	switch *link {
+	case "", "hardlink":
+		mode = dupes.Hardlink
+	case "reflink":
+		mode = dupes.Reflink
+	case "auto":
+		mode = dupes.ReflinkOrHardlink
+	default:
+		return fmt.Errorf("invalid --link: %s", *link)
+	}
+	if *link != "" && *undoLog == "" {
+		// replaced files can't be restored without the log
+		return fmt.Errorf("--link requires --undo-log")
+	}
+	if len(common.algs) > 1 {
+		return fmt.Errorf("dupes uses one algorithm, got %d", len(common.algs))
+	}
+	finder := dupes.Finder{Alg: dupes.DefaultAlg, PartialSize: *partial}
+	if len(common.algs) == 1 {
+		finder.Alg = common.algs[0]
+	}
+	groups, err := finder.Find(os.DirFS(dir), ".", common.walkOptions()...)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(stdout)
+	for _, g := range groups {
+		fmt.Fprintf(out, "%s (%d bytes wasted)\n", g.Digest, g.Wasted())
+		for _, p := range g.Paths {
+			fmt.Fprintf(out, "  %s\n", p)
+			for _, link := range g.Links[p] {
+				fmt.Fprintf(out, "  %s (hard link)\n", link)
+			}
+		}
+	}
+	fmt.Fprintf(out, "%d groups, %d bytes wasted\n", len(groups), dupes.TotalWasted(groups))
+	if *link == "" {
+		return out.Flush()
+	}
+	logFile, err := os.OpenFile(*undoLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	results, err := dupes.Link(dir, groups, mode, logFile)
+	failed := false
+	for _, r := range results {
+		if errors.Is(r.Err, dupes.ErrAlreadyLinked) {
+			continue
+		}
+		if r.Err != nil {
+			fmt.Fprintf(stderr, "not linked: %v\n", r.Err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s -> %s\n", r.Mode, r.Path, r.Target)
+	}
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := logFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// undoLinks restores files replaced by dupes --link
+func undoLinks(dir string, log string, stdout io.Writer) error {
+	f, err := os.Open(log)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	restored, err := dupes.Undo(dir, f)
+	for _, name := range restored {
+		fmt.Fprintln(stdout, "restored:", name)
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+// Command checksum calculates, verifies, and compares file checksums.
+//
+// Usage:
+//
+//	checksum hash [flags] DIR
+//	checksum verify [flags] MANIFEST [DIR]
+//	checksum diff [flags] OLD_MANIFEST (NEW_MANIFEST | DIR)
+//	checksum dupes [flags] DIR
+//
+// Run "checksum COMMAND -h" for the flags of each command.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/srerickson/checksum"
+)
+
+const usage = `usage: checksum COMMAND [flags] ARGS...
+
+commands:
+  hash    print checksums for files in a directory
+  verify  check files against a checksum manifest
+  diff    compare a checksum manifest to another manifest or a directory
+  dupes   list identical files in a directory
+`
+
+var commands = map[string]func(args []string, stdout, stderr io.Writer) error{
+	"hash":   runHash,
+	"verify": runVerify,
+	"diff":   runDiff,
+	"dupes":  runDupes,
+}
+
+// errFailed signals a non-zero exit without an additional message
+var errFailed = errors.New(`failed`)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err := run(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+		if err != errFailed {
+			fmt.Fprintln(os.Stderr, "checksum:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// listFlag is a flag.Value for repeated or comma-separated values
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// commonFlags are flags shared by all commands
+type commonFlags struct {
+	algs     listFlag
+	gos      int
+	includes listFlag
+	excludes listFlag
+	ignores  listFlag
+	follow   bool
+	maxBytes int64
+	maxOpens int64
+}
+
+func (c *commonFlags) register(fset *flag.FlagSet) {
+	fset.Var(&c.algs, "alg", "checksum algorithms, comma-separated ("+strings.Join(checksum.Algorithms(), ", ")+")")
+	c.registerWalk(fset)
+}
+
+// registerWalk registers the flags other than --alg, for commands that get
+// the algorithm from a manifest.
+func (c *commonFlags) registerWalk(fset *flag.FlagSet) {
+	fset.IntVar(&c.gos, "gos", 0, "number of files to checksum concurrently (default: number of CPUs)")
+	fset.Var(&c.includes, "include", "only checksum files matching the pattern (repeatable, .gitignore syntax)")
+	fset.Var(&c.excludes, "exclude", "skip files and directories matching the pattern (repeatable, .gitignore syntax)")
+	fset.BoolVar(&c.follow, "follow", false, "follow symbolic links")
+	fset.Int64Var(&c.maxBytes, "max-bytes", 0, "limit reads to this many bytes per second")
+	fset.Int64Var(&c.maxOpens, "max-opens", 0, "limit file opens to this many per second")
+	fset.Var(&c.ignores, "ignore-file", "name of ignore files to honor, e.g. .gitignore (repeatable)")
+}
+
+// options returns checksum options for the flags. If no algorithms were
+// given, defaultAlg is used.
+func (c *commonFlags) options(defaultAlg string) ([]func(*checksum.Config), error) {
+	if len(c.algs) == 0 {
+		c.algs = listFlag{defaultAlg}
+	}
+	var opts []func(*checksum.Config)
+	for i, name := range c.algs {
+		alg, err := checksum.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		c.algs[i] = alg.Name
+		opts = append(opts, checksum.WithAlg(alg.Name, alg.New))
+	}
+	return append(opts, c.walkOptions()...), nil
+}
+
+// walkOptions returns checksum options for the flags other than --alg.
+func (c *commonFlags) walkOptions() []func(*checksum.Config) {
+	var opts []func(*checksum.Config)
+	if c.gos > 0 {
+		opts = append(opts, checksum.WithGos(c.gos))
+	}
+	opts = append(opts,
+		checksum.WithInclude(c.includes...),
+		checksum.WithExclude(c.excludes...),
+		checksum.WithIgnoreFiles(c.ignores...))
+	if c.follow {
+		opts = append(opts, checksum.WithSymlinks(checksum.SymlinkFollow))
+	}
+	if c.maxBytes > 0 || c.maxOpens > 0 {
+		opts = append(opts, checksum.WithThrottle(checksum.NewThrottle(c.maxBytes, c.maxOpens)))
+	}
+	return opts
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const fixture = "../../test/fixture"
+
+// run runs the command and returns its standard output
+func run(t *testing.T, cmd func([]string, io.Writer, io.Writer) error, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := cmd(args, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+// failWriter fails every write
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errors.New(`write failed`) }
+
+func TestHash(t *testing.T) {
+	out, err := run(t, runHash, "--alg", "md5", fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "9d02fa6e9dd9f38327f7b213daa28be6  hello.csv\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	out, err = run(t, runHash, "--alg", "sha256", "--format", "bsd", "--encoding", "sri", fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "SHA256 (hello.csv) = sha256-") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	out, err = run(t, runHash, "--alg", "md5,sha1", "--format", "json", fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]any
+	if err := json.Unmarshal([]byte(out), &records); err != nil || len(records) != 4 {
+		t.Errorf("expected a JSON array with 4 records, got %v:\n%s", err, out)
+	}
+	if _, err := run(t, runHash, "--alg", "md5,sha1", fixture); err == nil {
+		t.Error("expected an error for gnu format with two algorithms")
+	}
+	// write errors aren't ignored
+	for _, format := range []string{"gnu", "json"} {
+		if err := runHash([]string{"--format", format, fixture}, failWriter{}, &bytes.Buffer{}); err == nil {
+			t.Errorf("%s: expected an error for failed write", format)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	sums, err := run(t, runHash, fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "SHA256SUMS")
+	if err := os.WriteFile(name, []byte(sums), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := run(t, runVerify, name, fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out, ": OK\n") != 4 {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	// every format written by hash can be verified
+	for _, args := range [][]string{
+		{"--format", "json", "--alg", "md5,sha1"},
+		{"--format", "jsonl"},
+		{"--format", "bsd", "--alg", "md5,sha256", "--encoding", "base64"},
+	} {
+		other, err := run(t, runHash, append(args, fixture)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherName := filepath.Join(t.TempDir(), "manifest")
+		if err := os.WriteFile(otherName, []byte(other), 0644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := run(t, runVerify, otherName, fixture)
+		if err != nil || strings.Count(out, ": OK\n") != 4 {
+			t.Errorf("%v: unexpected result: %v\n%s", args, err, out)
+		}
+	}
+	sums = strings.Replace(sums, "hello.csv", "missing.csv", 1)
+	if err := os.WriteFile(name, []byte(sums), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = run(t, runVerify, "--quiet", name, fixture)
+	if err != errFailed {
+		t.Errorf("expected errFailed, got %v", err)
+	}
+	if !strings.HasPrefix(out, "missing.csv: ") || strings.Contains(out, "OK") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	out, err := run(t, runHash, "--alg", "md5", fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := filepath.Join(dir, "v1.md5")
+	if err := os.WriteFile(v1, []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v2 := filepath.Join(dir, "v2.md5")
+	changed := strings.Replace(out, "hello.csv", "renamed.csv", 1)
+	if err := os.WriteFile(v2, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// manifest and directory
+	out, err = run(t, runDiff, v1, fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "0 added, 0 removed, 0 modified, 0 renamed, 4 unchanged\n" {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	// JSON manifests
+	out, err = run(t, runHash, "--alg", "md5", "--format", "json", fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1JSON := filepath.Join(dir, "v1.json")
+	if err := os.WriteFile(v1JSON, []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = run(t, runDiff, v1JSON, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out, "0 added, 0 removed, 0 modified, 1 renamed, 3 unchanged\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	// two manifests
+	out, err = run(t, runDiff, "--json", v1, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Summary map[string]int `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Summary["renamed"] != 1 || report.Summary["unchanged"] != 3 {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestDupes(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.txt":     "duplicate",
+		"sub/b.txt": "duplicate",
+		"c.txt":     "unique",
+	} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := run(t, runDupes, "--alg", "md5", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "  a.txt\n  sub/b.txt\n") || !strings.HasSuffix(out, "1 groups, 9 bytes wasted\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if _, err := run(t, runDupes, "--alg", "md5,sha1", dir); err == nil {
+		t.Error("expected an error for two algorithms")
+	}
+	if _, err := run(t, runDupes, "--link", "hardlink", dir); err == nil {
+		t.Error("expected an error for --link without --undo-log")
+	}
+	undoLog := filepath.Join(t.TempDir(), "undo")
+	out, err = run(t, runDupes, "--link", "hardlink", "--undo-log", undoLog, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "hardlink: sub/b.txt -> a.txt\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	out, err = run(t, runDupes, "--undo", undoLog, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "restored: sub/b.txt\n" {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	// followed symlinks aren't linked
+	if err := os.Symlink("a.txt", filepath.Join(dir, "ln.txt")); err != nil {
+		t.Fatal(err)
+	}
+	out, err = run(t, runDupes, "--follow", "--link", "hardlink", "--undo-log", undoLog, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "ln.txt") || !strings.Contains(out, "hardlink: sub/b.txt -> a.txt\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
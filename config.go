@@ -9,23 +9,67 @@ import (
 	"hash"
 	"io/fs"
 	"runtime"
+	"time"
+
+	"github.com/zeebo/xxh3"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+	"lukechampine.com/blake3"
 )
 
 const (
-	MD5    = `md5`
-	SHA1   = `sha1`
-	SHA512 = `sha512`
-	SHA256 = `sha256`
-	//BLAKE2B512 = `blake2b-512`
+	MD5        = `md5`
+	SHA1       = `sha1`
+	SHA512     = `sha512`
+	SHA384     = `sha384`
+	SHA256     = `sha256`
+	SHA3_256   = `sha3-256`
+	SHA3_512   = `sha3-512`
+	BLAKE2B512 = `blake2b-512`
+	BLAKE3     = `blake3`
+	XXH3       = `xxh3` // 64-bit, non-cryptographic
 )
 
+// NewBLAKE2b512 returns a new unkeyed blake2b-512 hash.Hash
+func NewBLAKE2b512() hash.Hash {
+	h, _ := blake2b.New512(nil) // only errors for invalid keys
+	return h
+}
+
+// NewBLAKE3 returns a new blake3 hash.Hash with a 256-bit digest
+func NewBLAKE3() hash.Hash {
+	return blake3.New(32, nil)
+}
+
+// NewXXH3 returns a new 64-bit xxh3 hash.Hash
+func NewXXH3() hash.Hash {
+	return xxh3.New()
+}
+
 // Config is a common configuration object
 // used by Walk(), NewPipe(), and Add().
 type Config struct {
 	numGos      int // number of goroutines in pool
 	ctx         context.Context
-	algs        map[string]func() hash.Hash
+	algs        map[string]*algFunc
 	walkDirFunc fs.WalkDirFunc
+	verifyExtra bool   // report files not in manifest
+	cache       *Cache // cache of previous checksums
+	// progress reporting
+	progressFunc     func(Stats)
+	progressInterval time.Duration
+	splitSize        int64 // min size for concurrent chunk hashing
+	ordered          bool  // Walk calls JobFunc in walk order
+	orderBuffer      int   // max jobs in flight for ordered Walk
+	bufferSize       int   // per-worker read buffer size
+	throttle         *Throttle
+	checkpoint       string // journal file for Walk
+	resume           bool   // resume from checkpoint
+	// walk filters
+	includes    []string
+	excludes    []string
+	ignoreFiles []string
+	symlinks    SymlinkMode
 }
 
 func defaultConfig() Config {
@@ -62,43 +106,100 @@ func WithCtx(ctx context.Context) func(*Config) {
 	}
 }
 
+// algFunc is a hash constructor from WithAlg(). Each WithAlg() option has its
+// own algFunc, which identifies the constructor for reusing hashes.
+type algFunc struct {
+	new func() hash.Hash
+}
+
 // WithAlg adds the named algorith to Walk() and NewPipe().
-// Can be repeated for different Algs.
+// Can be repeated for different Algs. A Pipe's go routines reuse hashes
+// across jobs only if the jobs' algorithms are from the same WithAlg()
+// options, so algorithms given to Add() with different constructors for the
+// same name are not mixed up. To reuse hashes for algorithms given to Add(),
+// call WithAlg() once and pass its result to each call.
 func WithAlg(name string, alg func() hash.Hash) func(*Config) {
+	f := &algFunc{new: alg}
 	return func(c *Config) {
 		if c.algs == nil {
-			c.algs = make(map[string]func() hash.Hash)
+			c.algs = make(map[string]*algFunc)
 		}
-		c.algs[name] = alg
+		c.algs[name] = f
 	}
 }
 
+// options for the package's algorithms are shared, so that hashes are reused
+// for jobs with algorithms given to Add()
+var (
+	withMD5        = WithAlg(MD5, md5.New)
+	withSHA1       = WithAlg(SHA1, sha1.New)
+	withSHA256     = WithAlg(SHA256, sha256.New)
+	withSHA512     = WithAlg(SHA512, sha512.New)
+	withSHA384     = WithAlg(SHA384, sha512.New384)
+	withSHA3_256   = WithAlg(SHA3_256, sha3.New256)
+	withSHA3_512   = WithAlg(SHA3_512, sha3.New512)
+	withBLAKE2b512 = WithAlg(BLAKE2B512, NewBLAKE2b512)
+	withBLAKE3     = WithAlg(BLAKE3, NewBLAKE3)
+	withXXH3       = WithAlg(XXH3, NewXXH3)
+	withSHA256Tree = WithAlg(SHA256Tree, NewSHA256Tree)
+)
+
 // WithMD5 adds the md5 algorith to Walk() and NewPipe().
 func WithMD5() func(*Config) {
-	return func(c *Config) {
-		WithAlg(MD5, md5.New)(c)
-	}
+	return withMD5
 }
 
 // WithSHA1 adds the sha1 algorith to Walk() and NewPipe().
 func WithSHA1() func(*Config) {
-	return func(c *Config) {
-		WithAlg(SHA1, sha1.New)(c)
-	}
+	return withSHA1
 }
 
 // WithSHA256 adds the sha256 algorith to Walk() and NewPipe().
 func WithSHA256() func(*Config) {
-	return func(c *Config) {
-		WithAlg(SHA256, sha256.New)(c)
-	}
+	return withSHA256
 }
 
 // WithSHA512 adds the sha512 algorith to Walk() and NewPipe().
 func WithSHA512() func(*Config) {
-	return func(c *Config) {
-		WithAlg(SHA512, sha512.New)(c)
-	}
+	return withSHA512
+}
+
+// WithSHA384 adds the sha384 algorith to Walk() and NewPipe().
+func WithSHA384() func(*Config) {
+	return withSHA384
+}
+
+// WithSHA3_256 adds the sha3-256 algorith to Walk() and NewPipe().
+func WithSHA3_256() func(*Config) {
+	return withSHA3_256
+}
+
+// WithSHA3_512 adds the sha3-512 algorith to Walk() and NewPipe().
+func WithSHA3_512() func(*Config) {
+	return withSHA3_512
+}
+
+// WithBLAKE2b512 adds the blake2b-512 algorith to Walk() and NewPipe().
+func WithBLAKE2b512() func(*Config) {
+	return withBLAKE2b512
+}
+
+// WithBLAKE3 adds the blake3 algorith (256-bit digest) to Walk() and
+// NewPipe().
+func WithBLAKE3() func(*Config) {
+	return withBLAKE3
+}
+
+// WithXXH3 adds the 64-bit xxh3 algorith to Walk() and NewPipe(). XXH3 is
+// fast but is not a cryptographic hash: it is suitable for finding
+// duplicates but not for detecting deliberate tampering.
+func WithXXH3() func(*Config) {
+	return withXXH3
+}
+
+// WithSHA256Tree adds the sha256 tree hash algorithm to Walk() and NewPipe().
+func WithSHA256Tree() func(*Config) {
+	return withSHA256Tree
 }
 
 // WithWalkDirFunc configures the WalkDirFunc use by Walk().
@@ -110,3 +211,138 @@ func WithWalkDirFunc(f fs.WalkDirFunc) func(*Config) {
 		c.walkDirFunc = f
 	}
 }
+
+// WithExtraFiles configures Verify() to report files that are found in the
+// FS but not in the manifest. Has no effect when used with Walk() or
+// NewPipe().
+func WithExtraFiles() func(*Config) {
+	return func(c *Config) {
+		c.verifyExtra = true
+	}
+}
+
+// WithCache configures Walk() and NewPipe() to use c for checksums of files
+// that have not changed since they were added to the cache. Newly calculated
+// checksums are added to c.
+func WithCache(c *Cache) func(*Config) {
+	return func(conf *Config) {
+		conf.cache = c
+	}
+}
+
+// WithProgress configures Walk() and NewPipe() to call f with the Pipe's
+// progress every interval, and once more when all jobs are complete. The
+// function is called from a separate go routine. With Walk(), the sizes of
+// files are included in the progress as soon as they are found.
+func WithProgress(interval time.Duration, f func(Stats)) func(*Config) {
+	return func(c *Config) {
+		if interval <= 0 {
+			interval = time.Second
+		}
+		c.progressInterval = interval
+		c.progressFunc = f
+	}
+}
+
+// WithSplitSize configures Walk() and NewPipe() to checksum files of at least
+// size bytes by reading chunks of the file concurrently: the Pipe's idle go
+// routines help the go routine checksumming the file, so no more than the
+// number set with WithGos() read at once. It only applies to jobs for which all
+// algorithms are TreeHash implementations (e.g., SHA256Tree) and to files
+// that implement io.ReaderAt (e.g., files from os.DirFS()). Other jobs are
+// read sequentially.
+func WithSplitSize(size int64) func(*Config) {
+	return func(c *Config) {
+		c.splitSize = size
+	}
+}
+
+// WithOrdered configures Walk() to call the JobFunc in lexical order (the
+// order of fs.WalkDir) rather than the order in which jobs complete. Files
+// are still checksummed concurrently. The size sets the maximum number of
+// jobs that may be in progress or waiting for earlier jobs to complete; if
+// size is less than 1, DefaultOrderBuffer is used. Has no effect when used
+// with NewPipe().
+func WithOrdered(size int) func(*Config) {
+	return func(c *Config) {
+		c.ordered = true
+		c.orderBuffer = size
+	}
+}
+
+// WithBufferSize sets the size of the read buffer used by each of the Pipe's
+// go routines. Buffers and hashes are reused across jobs. If size is less
+// than 1, DefaultBufferSize is used.
+func WithBufferSize(size int) func(*Config) {
+	return func(c *Config) {
+		c.bufferSize = size
+	}
+}
+
+// WithThrottle configures Walk() and NewPipe() to limit the rate of reads and
+// file opens using t. The same Throttle can be used with several Pipes to
+// limit their combined rate. See NewThrottle().
+func WithThrottle(t *Throttle) func(*Config) {
+	return func(c *Config) {
+		c.throttle = t
+	}
+}
+
+// WithCheckpoint configures Walk() to record the path, size, modification
+// time, and checksums of each successfully completed job in the named journal
+// file. The journal is flushed to disk periodically and when Walk returns. If
+// resume is false, any existing journal is replaced. If resume is true, paths
+// already recorded in the journal are not read again, provided the file's
+// size and modification time are unchanged and the journal has checksums for
+// all the job's algorithms. Instead, the recorded checksums are passed to the
+// JobFunc (see Job.Resumed()) in the course of the walk, so WithOrdered()
+// is respected. New results are appended to the journal. Has no effect when
+// used with NewPipe().
+func WithCheckpoint(name string, resume bool) func(*Config) {
+	return func(c *Config) {
+		c.checkpoint = name
+		c.resume = resume
+	}
+}
+
+// WithInclude configures Walk() to only checksum files with paths matching
+// at least one of the patterns. Patterns use .gitignore syntax: patterns
+// without a slash match file names at any depth (e.g., "*.txt"), other
+// patterns are matched against the path relative to the Walk's root (e.g.,
+// "data/**/*.csv"). Can be repeated. Has no effect when used with NewPipe().
+func WithInclude(patterns ...string) func(*Config) {
+	return func(c *Config) {
+		c.includes = append(c.includes, patterns...)
+	}
+}
+
+// WithExclude configures Walk() to skip files and directories with paths
+// matching any of the patterns, using the same syntax as WithInclude().
+// Patterns ending in "/" (e.g., ".git/") only match directories. Excluded
+// directories are not walked. Exclusions can't be negated by ignore files.
+// Can be repeated. Has no effect when used with NewPipe().
+func WithExclude(patterns ...string) func(*Config) {
+	return func(c *Config) {
+		c.excludes = append(c.excludes, patterns...)
+	}
+}
+
+// WithIgnoreFiles configures Walk() to read files with the given names
+// (e.g., ".gitignore", ".checksumignore") in each directory and skip the files
+// and directories they match. Ignore files use .gitignore syntax, including
+// negation with "!". Patterns in deeper directories take precedence. Can be
+// repeated. Has no effect when used with NewPipe().
+func WithIgnoreFiles(names ...string) func(*Config) {
+	return func(c *Config) {
+		c.ignoreFiles = append(c.ignoreFiles, names...)
+	}
+}
+
+// WithSymlinks sets how Walk() handles symbolic links (SymlinkSkip by
+// default). Following symlinks requires an fs.FS that resolves links when
+// opening files, like os.DirFS(). Has no effect when used with NewPipe().
+func WithSymlinks(mode SymlinkMode) func(*Config) {
+	return func(c *Config) {
+		c.symlinks = mode
+	}
+}
@@ -1,5 +1,7 @@
 package delta
 
+import "sort"
+
 // A Delta represents changes between two sets of files
 type Delta struct {
 	// all filenames and corresponding digests
@@ -72,6 +74,11 @@ func New(v1 FileSet, v2 FileSet) *Delta {
 			info.v1Removed = append(info.v1Removed, f)
 		}
 	}
+	// sorted so that renames are paired consistently
+	for _, info := range delta.allDigests {
+		sort.Strings(info.v1Removed)
+		sort.Strings(info.v2Added)
+	}
 	return &delta
 }
 
@@ -1,6 +1,9 @@
 package delta_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"reflect"
 	"sort"
 	"strings"
 	"testing"
@@ -70,3 +73,60 @@ func TestDelta(t *testing.T) {
 	}
 
 }
+
+func TestReport(t *testing.T) {
+	v1 := delta.FileSet{
+		"a": "1",
+		"b": "2",
+		"c": "3",
+		"d": "4",
+	}
+	v2 := delta.FileSet{
+		"a":  "1",  // unchanged
+		"b":  "2-", // modified
+		"c2": "3",  // renamed
+		"e":  "5",  // added
+	}
+	r := delta.New(v1, v2).Report()
+	expect := []delta.Change{
+		{Type: delta.Unchanged, Path: "a", OldDigest: "1", NewDigest: "1"},
+		{Type: delta.Modified, Path: "b", OldDigest: "2", NewDigest: "2-"},
+		{Type: delta.Renamed, Path: "c2", OldPath: "c", OldDigest: "3", NewDigest: "3"},
+		{Type: delta.Removed, Path: "d", OldDigest: "4"},
+		{Type: delta.Added, Path: "e", NewDigest: "5"},
+	}
+	if !reflect.DeepEqual(r.Changes, expect) {
+		t.Errorf("unexpected changes: %v", r.Changes)
+	}
+	if (r.Summary != delta.Summary{Added: 1, Removed: 1, Modified: 1, Renamed: 1, Unchanged: 1}) {
+		t.Errorf("unexpected summary: %+v", r.Summary)
+	}
+	if !r.Changed() {
+		t.Error("expected Changed() to be true")
+	}
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text := "M b\nR c -> c2\nD d\nA e\n1 added, 1 removed, 1 modified, 1 renamed, 1 unchanged\n"
+	if buf.String() != text {
+		t.Errorf("unexpected text: %q", buf.String())
+	}
+	buf.Reset()
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got delta.Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, r) {
+		t.Errorf("JSON round trip: expected %v, got %v", r, got)
+	}
+	if !strings.Contains(buf.String(), `"type": "renamed"`) {
+		t.Errorf("unexpected JSON: %s", buf.String())
+	}
+	if delta.New(v1, v1).Report().Changed() {
+		t.Error("expected Changed() to be false")
+	}
+}
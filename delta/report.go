@@ -0,0 +1,165 @@
+package delta
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ChangeType is the kind of change to a file in a Report
+type ChangeType int
+
+const (
+	Unchanged ChangeType = iota
+	Added
+	Removed
+	Modified
+	Renamed
+)
+
+var changeNames = [...]string{
+	Unchanged: `unchanged`,
+	Added:     `added`,
+	Removed:   `removed`,
+	Modified:  `modified`,
+	Renamed:   `renamed`,
+}
+
+func (t ChangeType) String() string {
+	if t < 0 || int(t) >= len(changeNames) {
+		return fmt.Sprintf("ChangeType(%d)", int(t))
+	}
+	return changeNames[t]
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (t ChangeType) MarshalText() ([]byte, error) {
+	if t < 0 || int(t) >= len(changeNames) {
+		return nil, fmt.Errorf("invalid change type: %d", int(t))
+	}
+	return []byte(changeNames[t]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (t *ChangeType) UnmarshalText(b []byte) error {
+	for i, name := range changeNames {
+		if string(b) == name {
+			*t = ChangeType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid change type: %q", b)
+}
+
+// Change is a change to a single file.
+type Change struct {
+	Type ChangeType `json:"type"`
+	// Path is the file's path in v2, or in v1 for removed files.
+	Path string `json:"path"`
+	// OldPath is the file's path in v1 for renamed files.
+	OldPath string `json:"old_path,omitempty"`
+	// OldDigest is the file's digest in v1. It is empty for added files.
+	OldDigest string `json:"old_digest,omitempty"`
+	// NewDigest is the file's digest in v2. It is empty for removed files.
+	NewDigest string `json:"new_digest,omitempty"`
+}
+
+// Summary counts the changes in a Report by type
+type Summary struct {
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Modified  int `json:"modified"`
+	Renamed   int `json:"renamed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Report is a list of all changes between two FileSets
+type Report struct {
+	Changes []Change `json:"changes"` // sorted by Path
+	Summary Summary  `json:"summary"`
+}
+
+// Report returns all the changes in the Delta, including unchanged files,
+// sorted by path.
+func (d *Delta) Report() Report {
+	r := Report{Changes: []Change{}}
+	for _, p := range d.Added() {
+		r.Changes = append(r.Changes, Change{Type: Added, Path: p, NewDigest: d.allNames[p].v2})
+	}
+	for _, p := range d.Removed() {
+		r.Changes = append(r.Changes, Change{Type: Removed, Path: p, OldDigest: d.allNames[p].v1})
+	}
+	for _, p := range d.Modified() {
+		pair := d.allNames[p]
+		r.Changes = append(r.Changes, Change{Type: Modified, Path: p, OldDigest: pair.v1, NewDigest: pair.v2})
+	}
+	oldNames, newNames := d.Renamed()
+	for i, p := range newNames {
+		dig := d.allNames[p].v2
+		r.Changes = append(r.Changes, Change{Type: Renamed, Path: p, OldPath: oldNames[i], OldDigest: dig, NewDigest: dig})
+	}
+	for _, p := range d.Same() {
+		dig := d.allNames[p].v1
+		r.Changes = append(r.Changes, Change{Type: Unchanged, Path: p, OldDigest: dig, NewDigest: dig})
+	}
+	sort.Slice(r.Changes, func(i, j int) bool {
+		if r.Changes[i].Path != r.Changes[j].Path {
+			return r.Changes[i].Path < r.Changes[j].Path
+		}
+		// a path may be removed (renamed) and also added
+		return r.Changes[i].Type < r.Changes[j].Type
+	})
+	for _, c := range r.Changes {
+		switch c.Type {
+		case Added:
+			r.Summary.Added++
+		case Removed:
+			r.Summary.Removed++
+		case Modified:
+			r.Summary.Modified++
+		case Renamed:
+			r.Summary.Renamed++
+		case Unchanged:
+			r.Summary.Unchanged++
+		}
+	}
+	return r
+}
+
+// Changed returns true if the report includes any changes other than
+// unchanged files.
+func (r Report) Changed() bool {
+	return r.Summary.Unchanged != len(r.Changes)
+}
+
+// WriteJSON writes the report to w as a JSON object.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report to w in a human-readable format: a line for
+// each added (A), removed (D), modified (M), and renamed (R) file, followed
+// by a summary line. Unchanged files are only counted in the summary.
+func (r Report) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range r.Changes {
+		switch c.Type {
+		case Added:
+			fmt.Fprintf(bw, "A %s\n", c.Path)
+		case Removed:
+			fmt.Fprintf(bw, "D %s\n", c.Path)
+		case Modified:
+			fmt.Fprintf(bw, "M %s\n", c.Path)
+		case Renamed:
+			fmt.Fprintf(bw, "R %s -> %s\n", c.OldPath, c.Path)
+		}
+	}
+	s := r.Summary
+	fmt.Fprintf(bw, "%d added, %d removed, %d modified, %d renamed, %d unchanged\n",
+		s.Added, s.Removed, s.Modified, s.Renamed, s.Unchanged)
+	return bw.Flush()
+}
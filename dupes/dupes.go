@@ -0,0 +1,389 @@
+// Package dupes finds files with identical content. To avoid reading files
+// unnecessarily, candidates are narrowed in stages: files are grouped by size,
+// then files with the same size are compared by checksums of their first and
+// last few KiB, and only files that still match are fully checksummed.
+package dupes
+
+import (
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/internal/fileid"
+)
+
+const (
+	// DefaultPartialSize is the number of bytes read from the start and end
+	// of candidate files if Finder.PartialSize is not set.
+	DefaultPartialSize = 16 * 1024
+	// DefaultAlg is the algorithm for full checksums if Finder.Alg is not set.
+	DefaultAlg = checksum.SHA256
+
+	// partialAlg is used for the partial checksums. Collisions only cause
+	// files to be fully checksummed, so it doesn't need to be cryptographic.
+	partialAlg = checksum.XXH3
+)
+
+// Group is a set of files with identical content.
+type Group struct {
+	Size   int64    // size of each file
+	Alg    string   // algorithm used for Digest
+	Digest string   // hex-encoded checksum of each file
+	Paths  []string // paths of the distinct files, sorted
+	// Links lists hard links to files in the group: the keys are from Paths,
+	// the values are other paths for the same file. Hard links are not
+	// counted as duplicates.
+	Links map[string][]string
+}
+
+// Wasted returns the number of bytes used by the duplicates in the group:
+// the size of all but one of the files.
+func (g Group) Wasted() int64 {
+	return g.Size * int64(len(g.Paths)-1)
+}
+
+// TotalWasted returns the sum of Wasted() for all groups.
+func TotalWasted(groups []Group) int64 {
+	var total int64
+	for _, g := range groups {
+		total += g.Wasted()
+	}
+	return total
+}
+
+// Finder finds duplicate files. The zero value is ready to use.
+type Finder struct {
+	// Alg is the name of the algorithm used for full checksums (see
+	// checksum.Lookup()). DefaultAlg is used if Alg is empty.
+	Alg string
+	// PartialSize is the number of bytes from the start and from the end of
+	// files used for partial checksums. Files no larger than twice the size
+	// are fully checksummed without partial checksums. DefaultPartialSize is
+	// used if PartialSize is less than 1.
+	PartialSize int64
+	// MinSize is the minimum size of files to consider. If it is less than 1,
+	// empty files are ignored.
+	MinSize int64
+}
+
+// Find returns groups of identical files under root in fsys, using a Finder
+// with default settings. See Finder.Find().
+func Find(fsys fs.FS, root string, opts ...func(*checksum.Config)) ([]Group, error) {
+	return Finder{}.Find(fsys, root, opts...)
+}
+
+// Find returns groups of identical files under root in fsys. Groups are
+// sorted by wasted bytes (largest first). Optional arguments are passed to
+// checksum.Walk() and checksum.NewPipe(), so they may be used to filter files
+// (checksum.WithExclude(), etc.), and to control concurrency and throttling.
+// Algorithm options are ignored; set Finder.Alg instead. Symlinks are never
+// reported as duplicates or as hard links, even if they are followed
+// (checksum.SymlinkFollow). Any error reading a file stops the search.
+func (f Finder) Find(fsys fs.FS, root string, opts ...func(*checksum.Config)) ([]Group, error) {
+	algName := f.Alg
+	if algName == "" {
+		algName = DefaultAlg
+	}
+	fullAlg, err := checksum.Lookup(algName)
+	if err != nil {
+		return nil, err
+	}
+	partAlg, err := checksum.Lookup(partialAlg)
+	if err != nil {
+		return nil, err
+	}
+	partSize := f.PartialSize
+	if partSize < 1 {
+		partSize = DefaultPartialSize
+	}
+	minSize := f.MinSize
+	if minSize < 1 {
+		minSize = 1
+	}
+
+	// stage 1: group by size
+	bySize, links, err := scan(fsys, root, minSize, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// stage 2: partial checksums for large files
+	var small, large []candidate
+	for size, paths := range bySize {
+		if len(paths) < 2 {
+			continue
+		}
+		for _, p := range paths {
+			c := candidate{path: p, size: size}
+			if size > 2*partSize {
+				large = append(large, c)
+				continue
+			}
+			small = append(small, c)
+		}
+	}
+	// partial checksums mustn't be cached as checksums of the whole file
+	partOpts := append(opts[:len(opts):len(opts)], checksum.WithCache(nil))
+	partialFS := &partialFS{FS: fsys, n: partSize}
+	large, err = narrow(partialFS, large, partAlg, partOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// stage 3: full checksums
+	full, err := checksumAll(fsys, append(small, large...), fullAlg, opts)
+	if err != nil {
+		return nil, err
+	}
+	var groups []Group
+	for key, paths := range groupBy(full) {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+		g := Group{Size: key.size, Alg: fullAlg.Name, Digest: key.digest, Paths: paths}
+		for _, p := range paths {
+			if l := links[p]; len(l) > 0 {
+				if g.Links == nil {
+					g.Links = map[string][]string{}
+				}
+				g.Links[p] = l
+			}
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if wi, wj := groups[i].Wasted(), groups[j].Wasted(); wi != wj {
+			return wi > wj
+		}
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+	return groups, nil
+}
+
+// candidate is a file that may have duplicates
+type candidate struct {
+	path   string
+	size   int64
+	digest string // from the most recent stage
+}
+
+type groupKey struct {
+	size   int64
+	digest string
+}
+
+func groupBy(cands []candidate) map[groupKey][]string {
+	groups := map[groupKey][]string{}
+	for _, c := range cands {
+		key := groupKey{size: c.size, digest: c.digest}
+		groups[key] = append(groups[key], c.path)
+	}
+	return groups
+}
+
+// scan walks root and returns paths of regular files grouped by size. Hard
+// links to the same file are only included once: the first path (in walk
+// order) is included and the others are returned in links, keyed by the
+// included path. Symlinks to files are ignored, and files in followed
+// directory symlinks are only included if there isn't another path for them.
+func scan(fsys fs.FS, root string, minSize int64, opts []func(*checksum.Config)) (map[int64][]string, map[string][]string, error) {
+	bySize := map[int64][]string{}
+	links := map[string][]string{}
+	seen := map[fileid.ID]string{}
+	aliased := map[string]bool{} // paths found through directory symlinks
+	throughLink := func(name string) bool {
+		for p := name; p != "." && p != "/"; p = path.Dir(p) {
+			if aliased[p] {
+				return true
+			}
+		}
+		return false
+	}
+	walkFunc := func(name string, d fs.DirEntry, err error) error {
+		if err == nil && checksum.IsFollowedLink(d) {
+			if !d.IsDir() {
+				return checksum.ErrSkipFile // not a copy
+			}
+			aliased[name] = true
+		}
+		if err := checksum.DefaultWalkDirFunc(name, d, err); err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() < minSize {
+			return checksum.ErrSkipFile
+		}
+		if id, ok := fileid.FromInfo(info); ok {
+			if first, exists := seen[id]; exists {
+				switch {
+				case throughLink(first) && !throughLink(name):
+					// prefer the path without symlinks
+					paths := bySize[info.Size()]
+					paths[slices.Index(paths, first)] = name
+					seen[id] = name
+				case !throughLink(first) && !throughLink(name):
+					links[first] = append(links[first], name)
+				}
+				return checksum.ErrSkipFile
+			}
+			seen[id] = name
+		}
+		bySize[info.Size()] = append(bySize[info.Size()], name)
+		return checksum.ErrSkipFile // nothing is checksummed in this stage
+	}
+	opts = append(opts[:len(opts):len(opts)], checksum.WithWalkDirFunc(walkFunc))
+	noop := func(checksum.Job, error) error { return nil }
+	if err := checksum.Walk(fsys, root, noop, opts...); err != nil {
+		return nil, nil, err
+	}
+	return bySize, links, nil
+}
+
+// narrow checksums the candidates and returns those whose size and checksum
+// match at least one other candidate.
+func narrow(fsys fs.FS, cands []candidate, alg checksum.Algorithm, opts []func(*checksum.Config)) ([]candidate, error) {
+	cands, err := checksumAll(fsys, cands, alg, opts)
+	if err != nil {
+		return nil, err
+	}
+	groups := groupBy(cands)
+	var matches []candidate
+	for _, c := range cands {
+		if len(groups[groupKey{size: c.size, digest: c.digest}]) > 1 {
+			matches = append(matches, c)
+		}
+	}
+	return matches, nil
+}
+
+// checksumAll returns cands with digests from alg, using a checksum.Pipe.
+func checksumAll(fsys fs.FS, cands []candidate, alg checksum.Algorithm, opts []func(*checksum.Config)) ([]candidate, error) {
+	if len(cands) == 0 {
+		return nil, nil
+	}
+	pipe, err := checksum.NewPipe(fsys, opts...)
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]candidate, len(cands))
+	for _, c := range cands {
+		byPath[c.path] = c
+	}
+	stop := make(chan struct{})
+	var addErr error // set before the pipe is closed
+	// one option for every job, so that the pipe reuses hashes
+	withAlg := checksum.WithAlg(alg.Name, alg.New)
+	go func() {
+		defer pipe.Close()
+		for _, c := range cands {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := pipe.Add(c.path, withAlg); err != nil {
+				addErr = err
+				return
+			}
+		}
+	}()
+	var results []candidate
+	var firstErr error
+	for j := range pipe.Out() {
+		if firstErr != nil {
+			continue // drain
+		}
+		if err := j.Err(); err != nil {
+			firstErr = err
+			close(stop)
+			continue
+		}
+		sum, err := j.Sum(alg.Name)
+		if err != nil {
+			firstErr = err
+			close(stop)
+			continue
+		}
+		c := byPath[j.Path()]
+		c.digest = hex.EncodeToString(sum)
+		results = append(results, c)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if addErr != nil {
+		return nil, addErr
+	}
+	return results, nil
+}
+
+// partialFS is an fs.FS with files that read as the first n and last n bytes
+// of the files in the underlying FS.
+type partialFS struct {
+	fs.FS
+	n int64
+}
+
+func (pfs *partialFS) Open(name string) (fs.File, error) {
+	f, err := pfs.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &partialFile{File: f, n: pfs.n}, nil
+}
+
+// partialFile reads the first n and last n bytes of the file. Stat() returns
+// the underlying file's info.
+type partialFile struct {
+	fs.File
+	n int64
+	r io.Reader
+}
+
+func (pf *partialFile) Read(p []byte) (int, error) {
+	if pf.r == nil {
+		info, err := pf.File.Stat()
+		if err != nil {
+			return 0, err
+		}
+		size := info.Size()
+		if size <= 2*pf.n {
+			pf.r = pf.File
+		} else if ra, ok := pf.File.(io.ReaderAt); ok {
+			pf.r = io.MultiReader(
+				io.NewSectionReader(ra, 0, pf.n),
+				io.NewSectionReader(ra, size-pf.n, pf.n))
+		} else {
+			// read and discard the middle
+			pf.r = io.MultiReader(
+				io.LimitReader(pf.File, pf.n),
+				&skipReader{r: pf.File, skip: size - 2*pf.n})
+		}
+	}
+	return pf.r.Read(p)
+}
+
+// skipReader discards the first skip bytes from r
+type skipReader struct {
+	r    io.Reader
+	skip int64
+}
+
+func (s *skipReader) Read(p []byte) (int, error) {
+	if s.skip > 0 {
+		n, err := io.CopyN(io.Discard, s.r, s.skip)
+		s.skip -= n
+		if err != nil {
+			return 0, err
+		}
+	}
+	return s.r.Read(p)
+}
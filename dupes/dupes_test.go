@@ -0,0 +1,311 @@
+package dupes_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/dupes"
+)
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	big := make([]byte, 100*1024)
+	rand.New(rand.NewSource(1)).Read(big)
+	middle := bytes.Clone(big)
+	middle[50*1024] ^= 0xff // same head and tail
+	head := bytes.Clone(big)
+	head[0] ^= 0xff
+	files := map[string][]byte{
+		"a.bin":       big,
+		"b/a.bin":     big,
+		"c.bin":       middle,
+		"d.bin":       head,
+		"x.txt":       []byte("hello"),
+		"y/x.txt":     []byte("hello"),
+		"z.txt":       []byte("world"),
+		"empty1":      nil,
+		"empty2":      nil,
+		"skip/a.bin":  big,
+		"skip/x.txt":  []byte("hello"),
+		"other/x.txt": []byte("hello"),
+	}
+	for name, data := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(filepath.Join(dir, "a.bin"), filepath.Join(dir, "link.bin")); err != nil {
+		t.Fatal(err)
+	}
+	finder := dupes.Finder{PartialSize: 1024, Alg: checksum.MD5}
+	groups, err := finder.Find(os.DirFS(dir), ".", checksum.WithExclude("skip/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d: %v", len(groups), groups)
+	}
+	expect := dupes.Group{
+		Size:   int64(len(big)),
+		Alg:    checksum.MD5,
+		Digest: groups[0].Digest,
+		Paths:  []string{"a.bin", "b/a.bin"},
+		Links:  map[string][]string{"a.bin": {"link.bin"}},
+	}
+	if !reflect.DeepEqual(groups[0], expect) {
+		t.Errorf("expected %v, got %v", expect, groups[0])
+	}
+	expect = dupes.Group{
+		Size:   5,
+		Alg:    checksum.MD5,
+		Digest: "5d41402abc4b2a76b9719d911017c592",
+		Paths:  []string{"other/x.txt", "x.txt", "y/x.txt"},
+	}
+	if !reflect.DeepEqual(groups[1], expect) {
+		t.Errorf("expected %v, got %v", expect, groups[1])
+	}
+	if w := dupes.TotalWasted(groups); w != int64(len(big))+10 {
+		t.Errorf("unexpected wasted bytes: %d", w)
+	}
+
+	// default settings, no filter
+	groups, err = dupes.Find(os.DirFS(dir), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || len(groups[0].Paths) != 3 || len(groups[1].Paths) != 4 {
+		t.Errorf("unexpected groups: %v", groups)
+	}
+	if _, err := (dupes.Finder{Alg: "nope"}).Find(os.DirFS(dir), "."); err == nil {
+		t.Error("expected an error for unknown algorithm")
+	}
+
+	// partial checksums aren't cached
+	cache := checksum.NewCache()
+	if _, err := dupes.Find(os.DirFS(dir), ".", checksum.WithCache(cache)); err != nil {
+		t.Fatal(err)
+	}
+	xxh3 := map[string]string{}
+	each := func(j checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		xxh3[j.Path()], err = j.SumString(checksum.XXH3)
+		return err
+	}
+	err = checksum.Walk(os.DirFS(dir), ".", each, checksum.WithXXH3(), checksum.WithCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xxh3["a.bin"] == xxh3["c.bin"] {
+		t.Errorf("files with different content have the same xxh3: %s", xxh3["a.bin"])
+	}
+
+	// canceled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := dupes.Find(os.DirFS(dir), ".", checksum.WithCtx(ctx)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestFindSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"f1", "f2"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "f3"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// symlinks to a file and to a directory, which is walked first
+	if err := os.Symlink("f1", filepath.Join(dir, "ln")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub", filepath.Join(dir, "a-dir")); err != nil {
+		t.Fatal(err)
+	}
+	expect := []dupes.Group{{
+		Size:   7,
+		Alg:    checksum.MD5,
+		Digest: "9a0364b9e99bb480dd25e1f0284c8555",
+		Paths:  []string{"f1", "f2", "sub/f3"},
+	}}
+	// symlinks aren't duplicates or hard links
+	modes := []checksum.SymlinkMode{checksum.SymlinkSkip, checksum.SymlinkReport, checksum.SymlinkFollow}
+	for _, mode := range modes {
+		groups, err := dupes.Finder{Alg: checksum.MD5}.Find(os.DirFS(dir), ".", checksum.WithSymlinks(mode))
+		if err != nil {
+			t.Fatalf("mode %d: %v", mode, err)
+		}
+		if !reflect.DeepEqual(groups, expect) {
+			t.Errorf("mode %d: expected %v, got %v", mode, expect, groups)
+		}
+	}
+}
+
+func TestLink(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":   "duplicate content",
+		"b.txt":   "duplicate content",
+		"c/b.txt": "duplicate content",
+		"d.txt":   "other content",
+		"e.txt":   "other content",
+	}
+	for name, data := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(filepath.Join(dir, "b.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	groups, err := dupes.Find(os.DirFS(dir), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+	// e.txt changes after Find
+	if err := os.WriteFile(filepath.Join(dir, "e.txt"), []byte("changed content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sameFile := func(a, b string) bool {
+		infoA, err := os.Stat(filepath.Join(dir, a))
+		if err != nil {
+			t.Fatal(err)
+		}
+		infoB, err := os.Stat(filepath.Join(dir, b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return os.SameFile(infoA, infoB)
+	}
+	undo := &bytes.Buffer{}
+	results, err := dupes.Link(dir, groups, dupes.Hardlink, undo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked := map[string]bool{}
+	for _, r := range results {
+		if r.Err != nil {
+			if r.Path != "e.txt" || !errors.Is(r.Err, dupes.ErrNotDuplicate) {
+				t.Errorf("%s: unexpected error: %v", r.Path, r.Err)
+			}
+			continue
+		}
+		linked[r.Path] = true
+		if !sameFile(r.Path, r.Target) {
+			t.Errorf("%s: not linked to %s", r.Path, r.Target)
+		}
+	}
+	for _, name := range []string{"b.txt", "link.txt", "c/b.txt"} {
+		if !linked[name] {
+			t.Errorf("%s: not linked", name)
+		}
+	}
+	log := undo.String()
+	// a missing file doesn't stop Undo
+	if err := os.Rename(filepath.Join(dir, "c/b.txt"), filepath.Join(dir, "c/moved.txt")); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := dupes.Undo(dir, strings.NewReader(log))
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected an error for the missing file, got %v", err)
+	}
+	if len(restored) != 2 {
+		t.Errorf("expected 2 restored files, got %v", restored)
+	}
+	if !sameFile("b.txt", "link.txt") {
+		t.Error("b.txt and link.txt should be linked again after Undo")
+	}
+	if err := os.Rename(filepath.Join(dir, "c/moved.txt"), filepath.Join(dir, "c/b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	// restored content must match the digest
+	badLog := strings.ReplaceAll(log, groups[0].Digest, strings.Repeat("0", len(groups[0].Digest)))
+	if _, err := dupes.Undo(dir, strings.NewReader(badLog)); err == nil {
+		t.Error("expected an error for the wrong digest")
+	}
+	if !sameFile("c/b.txt", "a.txt") {
+		t.Error("c/b.txt shouldn't be restored with the wrong digest")
+	}
+	more, err := dupes.Undo(dir, strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(more) != 1 || more[0] != "c/b.txt" {
+		t.Errorf("expected c/b.txt to be restored, got %v", more)
+	}
+	restored = append(restored, more...)
+	for _, name := range restored {
+		if sameFile(name, "a.txt") {
+			t.Errorf("%s: still linked after Undo", name)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != files["a.txt"] {
+			t.Errorf("%s: unexpected content after Undo: %q", name, b)
+		}
+	}
+
+	// reflinks may not be supported by the test filesystem
+	results, err = dupes.Link(dir, groups[:1], dupes.Reflink, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Err != nil && !errors.Is(r.Err, dupes.ErrReflinkUnsupported) {
+			t.Errorf("%s: unexpected error: %v", r.Path, r.Err)
+		}
+		if r.Err == nil && sameFile(r.Path, r.Target) {
+			t.Errorf("%s: reflink is a hard link", r.Path)
+		}
+	}
+	results, err = dupes.Link(dir, groups[:1], dupes.ReflinkOrHardlink, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.Path, r.Err)
+		}
+	}
+	results, err = dupes.Link(dir, groups[:1], dupes.Hardlink, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 {
+		t.Error("expected results for already linked files")
+	}
+	for _, r := range results {
+		if !errors.Is(r.Err, dupes.ErrAlreadyLinked) {
+			t.Errorf("%s: expected ErrAlreadyLinked, got %v", r.Path, r.Err)
+		}
+	}
+}
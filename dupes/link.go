@@ -0,0 +1,404 @@
+package dupes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/srerickson/checksum"
+)
+
+// LinkMode determines how Link() replaces duplicates.
+type LinkMode int
+
+const (
+	// Hardlink replaces duplicates with hard links. Linked paths share
+	// permissions, ownership, and modification time, and changes made
+	// through one path are visible through the others.
+	Hardlink LinkMode = iota
+	// Reflink replaces duplicates with copy-on-write clones (FICLONE on
+	// linux), which share storage but are otherwise independent files.
+	// Duplicates are left unchanged (with ErrReflinkUnsupported) if the
+	// filesystem or platform doesn't support reflinks.
+	Reflink
+	// ReflinkOrHardlink uses reflinks where supported and hard links
+	// otherwise.
+	ReflinkOrHardlink
+)
+
+func (m LinkMode) String() string {
+	switch m {
+	case Hardlink:
+		return "hardlink"
+	case Reflink:
+		return "reflink"
+	case ReflinkOrHardlink:
+		return "reflink-or-hardlink"
+	}
+	return fmt.Sprintf("LinkMode(%d)", int(m))
+}
+
+var (
+	// ErrReflinkUnsupported is reported by Link() for duplicates that could
+	// not be cloned because reflinks aren't supported.
+	ErrReflinkUnsupported = errors.New(`reflinks not supported`)
+	// ErrNotDuplicate is reported by Link() for files that don't have the
+	// same content as the file they would be linked to, e.g., because one of
+	// them changed after the duplicates were found.
+	ErrNotDuplicate = errors.New(`files are not identical`)
+	// ErrAlreadyLinked is reported by Link() for duplicates that are already
+	// hard links to the file they would be linked to.
+	ErrAlreadyLinked = errors.New(`already linked`)
+)
+
+// LinkResult describes the outcome of replacing a duplicate.
+type LinkResult struct {
+	Path   string   // the duplicate
+	Target string   // the file Path was linked to
+	Mode   LinkMode // Hardlink or Reflink
+	Err    error    // if not nil, Path was not changed
+}
+
+// undoEntry is a line in the undo log
+type undoEntry struct {
+	Path    string      `json:"path"`
+	Target  string      `json:"target"`
+	Mode    string      `json:"mode"`
+	Perm    os.FileMode `json:"perm"`
+	ModTime time.Time   `json:"mtime"`
+	Size    int64       `json:"size"`
+	Alg     string      `json:"alg"`
+	Digest  string      `json:"digest"`
+	// Link is the duplicate that Path was a hard link to, for paths from
+	// Group.Links.
+	Link string `json:"link,omitempty"`
+}
+
+// Link replaces duplicates in groups with links to the first path in each
+// group. Paths are relative to dir, which should be the directory passed to
+// Find() (via os.DirFS). Other hard links to a duplicate (Group.Links) are
+// replaced too. Each duplicate is compared byte-for-byte with the target
+// immediately before it is replaced; the replacement is atomic. If undo is
+// not nil, a JSON line describing each replaced file is written to it, which
+// can be used with Undo(). The returned results describe each file that was
+// replaced or skipped. The error is only non-nil if the undo log can't be
+// written, in which case no more files are replaced.
+func Link(dir string, groups []Group, mode LinkMode, undo io.Writer) ([]LinkResult, error) {
+	var results []LinkResult
+	for _, g := range groups {
+		if len(g.Paths) < 2 {
+			continue
+		}
+		target := g.Paths[0]
+		for _, dupe := range g.Paths[1:] {
+			for i, p := range append([]string{dupe}, g.Links[dupe]...) {
+				result := LinkResult{Path: p, Target: target}
+				var entry *undoEntry
+				result.Mode, entry, result.Err = linkFile(dir, p, target, mode)
+				if entry != nil && undo != nil {
+					entry.Alg, entry.Digest = g.Alg, g.Digest
+					if i > 0 {
+						entry.Link = dupe
+					}
+					b, err := json.Marshal(entry)
+					if err == nil {
+						_, err = undo.Write(append(b, '\n'))
+					}
+					if err != nil {
+						return append(results, result), fmt.Errorf(`writing undo log: %w`, err)
+					}
+				}
+				results = append(results, result)
+			}
+		}
+	}
+	return results, nil
+}
+
+// linkFile replaces name with a link to target
+func linkFile(dir, name, target string, mode LinkMode) (LinkMode, *undoEntry, error) {
+	namePath := filepath.Join(dir, filepath.FromSlash(name))
+	targetPath := filepath.Join(dir, filepath.FromSlash(target))
+	before, err := os.Lstat(namePath)
+	if err != nil {
+		return mode, nil, err
+	}
+	if !before.Mode().IsRegular() {
+		return mode, nil, fmt.Errorf(`%s: %w`, name, ErrNotDuplicate)
+	}
+	targetInfo, err := os.Stat(targetPath)
+	if err != nil {
+		return mode, nil, err
+	}
+	if os.SameFile(before, targetInfo) {
+		return Hardlink, nil, fmt.Errorf(`%s: %w`, name, ErrAlreadyLinked)
+	}
+	if err := sameContent(namePath, targetPath); err != nil {
+		return mode, nil, fmt.Errorf(`%s: %w`, name, err)
+	}
+	tmp, used, err := makeLink(namePath, targetPath, before.Mode().Perm(), mode)
+	if err != nil {
+		return mode, nil, fmt.Errorf(`%s: %w`, name, err)
+	}
+	// don't replace the file if either file changed since they were compared
+	after, err := os.Lstat(namePath)
+	if err == nil && changed(before, after) {
+		err = fmt.Errorf(`%s: changed during link: %w`, name, ErrNotDuplicate)
+	}
+	if err == nil {
+		var targetAfter os.FileInfo
+		targetAfter, err = os.Stat(targetPath)
+		if err == nil && changed(targetInfo, targetAfter) {
+			err = fmt.Errorf(`%s: changed during link: %w`, target, ErrNotDuplicate)
+		}
+	}
+	if err == nil && used == Reflink {
+		err = os.Chtimes(tmp, before.ModTime(), before.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp, namePath)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return used, nil, err
+	}
+	entry := &undoEntry{
+		Path:    name,
+		Target:  target,
+		Mode:    used.String(),
+		Perm:    before.Mode().Perm(),
+		ModTime: before.ModTime(),
+		Size:    before.Size(),
+	}
+	return used, entry, nil
+}
+
+// changed returns true if after is not the same file as before or if its
+// size or modification time changed.
+func changed(before, after os.FileInfo) bool {
+	return !os.SameFile(before, after) || after.Size() != before.Size() ||
+		!after.ModTime().Equal(before.ModTime())
+}
+
+// makeLink creates a link to target in a temporary file next to name and
+// returns the temporary file's path.
+func makeLink(name, target string, perm os.FileMode, mode LinkMode) (string, LinkMode, error) {
+	if mode == Reflink || mode == ReflinkOrHardlink {
+		tmp, err := tempName(name)
+		if err != nil {
+			return "", mode, err
+		}
+		err = reflink(tmp, target, perm)
+		if err == nil {
+			return tmp, Reflink, nil
+		}
+		os.Remove(tmp)
+		if mode == Reflink || !errors.Is(err, ErrReflinkUnsupported) {
+			return "", Reflink, err
+		}
+	}
+	// hard link
+	for i := 0; ; i++ {
+		tmp, err := tempName(name)
+		if err != nil {
+			return "", Hardlink, err
+		}
+		if err := os.Remove(tmp); err != nil {
+			return "", Hardlink, err
+		}
+		err = os.Link(target, tmp)
+		if err == nil {
+			return tmp, Hardlink, nil
+		}
+		if !errors.Is(err, os.ErrExist) || i > 10 {
+			return "", Hardlink, err
+		}
+	}
+}
+
+// tempName creates an empty file with a unique name in the same directory as
+// name and returns its path.
+func tempName(name string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// sameContent returns ErrNotDuplicate if the named files' contents differ.
+func sameContent(a, b string) error {
+	fa, err := os.Open(a)
+	if err != nil {
+		return err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return err
+	}
+	defer fb.Close()
+	bufA := make([]byte, 64*1024)
+	bufB := make([]byte, len(bufA))
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if na != nb || !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return ErrNotDuplicate
+		}
+		eofA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		eofB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !eofA {
+			return errA
+		}
+		if errB != nil && !eofB {
+			return errB
+		}
+		if eofA || eofB {
+			if eofA != eofB {
+				return ErrNotDuplicate
+			}
+			return nil
+		}
+	}
+}
+
+// Undo reverses the changes recorded in an undo log written by Link(). Each
+// replaced file is restored as an independent copy of its content, with its
+// original permissions and modification time, and files that were hard links
+// to each other before Link() (Group.Links) are linked to each other again.
+// The content of each restored copy is checked against the digest in the log
+// before it replaces the link. Files that are no longer links to their target
+// (e.g., because they were changed or replaced after Link()) are left alone.
+// An error for one file doesn't stop Undo: the returned error combines the
+// errors for all files. It returns the paths that were restored.
+func Undo(dir string, log io.Reader) ([]string, error) {
+	var entries []undoEntry
+	scanner := bufio.NewScanner(log)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e undoEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf(`reading undo log: %w`, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf(`reading undo log: %w`, err)
+	}
+	var restored []string
+	var errs []error
+	done := map[string]bool{} // restored paths
+	// restore duplicates before the hard links to them; later entries first
+	for _, links := range []bool{false, true} {
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			if (e.Link != "") != links || done[e.Path] {
+				continue
+			}
+			ok, err := restore(dir, e, done)
+			if err != nil {
+				errs = append(errs, fmt.Errorf(`%s: %w`, e.Path, err))
+				continue
+			}
+			if ok {
+				done[e.Path] = true
+				restored = append(restored, e.Path)
+			}
+		}
+	}
+	return restored, errors.Join(errs...)
+}
+
+// restore reverses the change recorded in e. It returns false if the file is
+// no longer the link created by Link().
+func restore(dir string, e undoEntry, done map[string]bool) (bool, error) {
+	name := filepath.Join(dir, filepath.FromSlash(e.Path))
+	info, err := os.Lstat(name)
+	if err != nil {
+		return false, err
+	}
+	switch e.Mode {
+	case Hardlink.String():
+		targetInfo, err := os.Stat(filepath.Join(dir, filepath.FromSlash(e.Target)))
+		if err != nil {
+			return false, err
+		}
+		if !os.SameFile(info, targetInfo) {
+			return false, nil
+		}
+	case Reflink.String():
+		// Link() sets reflinks' modification times
+		if info.Size() != e.Size || !info.ModTime().Equal(e.ModTime) {
+			return false, nil
+		}
+	default:
+		return false, fmt.Errorf(`invalid link mode in undo log: %q`, e.Mode)
+	}
+	if e.Link != "" && done[e.Link] {
+		// the duplicate this was a hard link to has been restored
+		tmp, _, err := makeLink(name, filepath.Join(dir, filepath.FromSlash(e.Link)), 0, Hardlink)
+		if err == nil {
+			err = os.Rename(tmp, name)
+		}
+		if err != nil {
+			os.Remove(tmp)
+			return false, err
+		}
+		return true, nil
+	}
+	alg, err := checksum.Lookup(e.Alg)
+	if err != nil {
+		return false, err
+	}
+	if err := unshare(name, e.Perm, e.ModTime, alg, e.Digest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// unshare replaces name with a copy of itself. The copy's digest for alg must
+// match digest.
+func unshare(name string, perm os.FileMode, modTime time.Time, alg checksum.Algorithm, digest string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	h := alg.New()
+	_, err = io.Copy(io.MultiWriter(dst, h), src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); err == nil && !strings.EqualFold(sum, digest) {
+		err = fmt.Errorf(`restored content has %s %s, expected %s`, alg.Name, sum, digest)
+	}
+	if err == nil {
+		err = os.Chmod(dst.Name(), perm)
+	}
+	if err == nil {
+		err = os.Chtimes(dst.Name(), modTime, modTime)
+	}
+	if err == nil {
+		err = os.Rename(dst.Name(), name)
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+	}
+	return err
+}
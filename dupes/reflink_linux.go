@@ -0,0 +1,35 @@
+package dupes
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink clones target to name, which must exist, using FICLONE.
+func reflink(name, target string, perm os.FileMode) error {
+	src, err := os.Open(target)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+	if closeErr := dst.Close(); err == nil && closeErr != nil {
+		return closeErr
+	}
+	switch {
+	case err == nil:
+		return os.Chmod(name, perm)
+	case errors.Is(err, unix.EOPNOTSUPP), errors.Is(err, unix.ENOTSUP),
+		errors.Is(err, unix.EXDEV), errors.Is(err, unix.EINVAL),
+		errors.Is(err, unix.ENOTTY), errors.Is(err, unix.ENOSYS):
+		return fmt.Errorf(`%w: %v`, ErrReflinkUnsupported, err)
+	}
+	return err
+}
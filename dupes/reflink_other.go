@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package dupes
+
+import "os"
+
+// reflink always returns ErrReflinkUnsupported on this platform.
+func reflink(name, target string, perm os.FileMode) error {
+	return ErrReflinkUnsupported
+}
@@ -0,0 +1,272 @@
+package checksum
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Encoding is a string representation for digests. See Job.SumEncoded().
+type Encoding int
+
+const (
+	// Hex is lowercase hexadecimal, as returned by Job.SumString().
+	Hex Encoding = iota
+	// Base64 is standard base64 with padding (RFC 4648).
+	Base64
+	// Base64URL is URL-safe base64 without padding (RFC 4648).
+	Base64URL
+	// Base32 is standard base32 with padding (RFC 4648).
+	Base32
+	// Multihash is a multihash (the algorithm's multicodec code, the digest
+	// length, and the digest) encoded as base58btc multibase (with a 'z'
+	// prefix), as used by IPFS. Only algorithms with a multicodec code can be
+	// encoded.
+	Multihash
+	// SRI is the Subresource Integrity format: the algorithm name, a dash,
+	// and the base64 digest (e.g., "sha384-..."). Only sha256, sha384, and
+	// sha512 can be encoded.
+	SRI
+)
+
+// ErrInvalidDigest is returned when a digest can't be decoded or encoded.
+var ErrInvalidDigest = errors.New(`invalid digest`)
+
+var encodingNames = map[Encoding]string{
+	Hex:       `hex`,
+	Base64:    `base64`,
+	Base64URL: `base64url`,
+	Base32:    `base32`,
+	Multihash: `multihash`,
+	SRI:       `sri`,
+}
+
+func (e Encoding) String() string {
+	if name, ok := encodingNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("Encoding(%d)", int(e))
+}
+
+// ParseEncoding returns the Encoding with the given name: hex, base64,
+// base64url, base32, multihash, or sri.
+func ParseEncoding(name string) (Encoding, error) {
+	for e, n := range encodingNames {
+		if strings.EqualFold(name, n) {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown digest encoding: %q", name)
+}
+
+// multihashCodes are the multicodec codes for registered algorithms, by
+// canonical name.
+var multihashCodes = map[string]uint64{
+	MD5:        0xd5,
+	SHA1:       0x11,
+	SHA256:     0x12,
+	SHA512:     0x13,
+	SHA384:     0x20,
+	SHA3_512:   0x14,
+	SHA3_256:   0x16,
+	BLAKE2B512: 0xb240,
+	BLAKE3:     0x1e,
+}
+
+// sriAlgs are the algorithms allowed in Subresource Integrity strings
+var sriAlgs = map[string]bool{SHA256: true, SHA384: true, SHA512: true}
+
+// Encode returns sum, a digest for the named algorithm, as a string. The
+// algorithm is only used by the Multihash and SRI encodings and for checking
+// the digest's length; it is resolved with Lookup().
+func (e Encoding) Encode(alg string, sum []byte) (string, error) {
+	a, algErr := Lookup(alg)
+	if algErr == nil && a.Size != len(sum) {
+		return "", fmt.Errorf("%w: %d bytes for %s", ErrInvalidDigest, len(sum), a.Name)
+	}
+	switch e {
+	case Hex:
+		return hex.EncodeToString(sum), nil
+	case Base64:
+		return base64.StdEncoding.EncodeToString(sum), nil
+	case Base64URL:
+		return base64.RawURLEncoding.EncodeToString(sum), nil
+	case Base32:
+		return base32.StdEncoding.EncodeToString(sum), nil
+	case Multihash:
+		if algErr != nil {
+			return "", algErr
+		}
+		code, ok := multihashCodes[a.Name]
+		if !ok {
+			return "", fmt.Errorf("no multihash code for %s", a.Name)
+		}
+		mh := binary.AppendUvarint(nil, code)
+		mh = binary.AppendUvarint(mh, uint64(len(sum)))
+		return "z" + base58Encode(append(mh, sum...)), nil
+	case SRI:
+		if algErr != nil {
+			return "", algErr
+		}
+		if !sriAlgs[a.Name] {
+			return "", fmt.Errorf("%s can't be used for subresource integrity", a.Name)
+		}
+		return a.Name + "-" + base64.StdEncoding.EncodeToString(sum), nil
+	}
+	return "", fmt.Errorf("unknown digest encoding: %s", e)
+}
+
+// Decode returns the digest encoded in s. For the Multihash and SRI
+// encodings, the canonical name of the algorithm is also returned; otherwise
+// alg is empty. Decoding is lenient: hex may be upper or lower case, base64
+// and base32 padding is optional, and multihashes may use any of the
+// multibase prefixes for hex, base32, base58btc, or base64 (or no prefix for
+// base58btc multihashes starting with "Qm").
+func (e Encoding) Decode(s string) (alg string, sum []byte, err error) {
+	switch e {
+	case Hex:
+		sum, err = hex.DecodeString(s)
+	case Base64:
+		sum, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	case Base64URL:
+		sum, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	case Base32:
+		sum, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(
+			strings.ToUpper(strings.TrimRight(s, "=")))
+	case Multihash:
+		return decodeMultihash(s)
+	case SRI:
+		return decodeSRI(s)
+	default:
+		return "", nil, fmt.Errorf("unknown digest encoding: %s", e)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidDigest, err)
+	}
+	return "", sum, nil
+}
+
+func decodeSRI(s string) (string, []byte, error) {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), "?") // ignore options
+	// base64 has no dashes, but names may (e.g., "SHA-384")
+	i := strings.LastIndex(s, "-")
+	if i < 0 {
+		return "", nil, fmt.Errorf("%w: %q", ErrInvalidDigest, s)
+	}
+	name, b64 := s[:i], s[i+1:]
+	a, err := Lookup(name)
+	if err != nil {
+		return "", nil, err
+	}
+	if !sriAlgs[a.Name] {
+		return "", nil, fmt.Errorf("%w: %s can't be used for subresource integrity", ErrInvalidDigest, a.Name)
+	}
+	_, sum, err := Base64.Decode(b64)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(sum) != a.Size {
+		return "", nil, fmt.Errorf("%w: %d bytes for %s", ErrInvalidDigest, len(sum), a.Name)
+	}
+	return a.Name, sum, nil
+}
+
+func decodeMultihash(s string) (string, []byte, error) {
+	if s == "" {
+		return "", nil, fmt.Errorf("%w: empty multihash", ErrInvalidDigest)
+	}
+	var mh []byte
+	var err error
+	switch prefix, rest := s[0], s[1:]; prefix {
+	case 'z':
+		mh, err = base58Decode(rest)
+	case 'Q':
+		mh, err = base58Decode(s)
+	case 'f', 'F':
+		_, mh, err = Hex.Decode(rest)
+	case 'b', 'B':
+		_, mh, err = Base32.Decode(rest)
+	case 'm', 'M':
+		_, mh, err = Base64.Decode(rest)
+	case 'u', 'U':
+		_, mh, err = Base64URL.Decode(rest)
+	default:
+		err = fmt.Errorf("%w: unsupported multibase prefix %q", ErrInvalidDigest, prefix)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	code, n := binary.Uvarint(mh)
+	if n <= 0 {
+		return "", nil, fmt.Errorf("%w: invalid multihash code", ErrInvalidDigest)
+	}
+	mh = mh[n:]
+	size, n := binary.Uvarint(mh)
+	if n <= 0 || uint64(len(mh)-n) != size {
+		return "", nil, fmt.Errorf("%w: invalid multihash length", ErrInvalidDigest)
+	}
+	for name, c := range multihashCodes {
+		if c == code {
+			return name, mh[n:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w: unknown multihash code 0x%x", ErrInvalidDigest, code)
+}
+
+const base58Alphabet = `123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz`
+
+// base58Encode encodes b with the bitcoin base58 alphabet
+func base58Encode(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0]) // leading zeros
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// base58Decode decodes s with the bitcoin base58 alphabet
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	zeros := 0
+	for i := 0; i < len(s) && s[i] == base58Alphabet[0]; i++ {
+		zeros++
+	}
+	for i := 0; i < len(s); i++ {
+		idx := strings.IndexByte(base58Alphabet, s[i])
+		if idx < 0 {
+			return nil, fmt.Errorf("%w: invalid base58 character %q", ErrInvalidDigest, s[i])
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(idx)))
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// SumEncoded returns the checksum for the named algorithm using the given
+// encoding. See Sum() and Encoding.Encode().
+func (j Job) SumEncoded(name string, enc Encoding) (string, error) {
+	s, err := j.Sum(name)
+	if err != nil {
+		return "", err
+	}
+	return enc.Encode(name, s)
+}
@@ -7,7 +7,7 @@ import (
 	"os"
 	"strings"
 
-	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/dupes"
 )
 
 func main() {
@@ -16,31 +16,16 @@ func main() {
 	if dir == "" {
 		log.Fatal(`required argument: the directory to checksum`)
 	}
-	dirFS := os.DirFS(dir)
-	duplicates := make(map[string][]string)
-	each := func(j checksum.Job, err error) error {
-		if err != nil {
-			return err
-		}
-		sum, err := j.SumString(checksum.MD5)
-		if err != nil {
-			return err
-		}
-		duplicates[sum] = append(duplicates[sum], j.Path())
-		return nil
-	}
-	err := checksum.Walk(dirFS, `.`, each, checksum.WithMD5())
+	groups, err := dupes.Find(os.DirFS(dir), `.`)
 	if err != nil {
 		log.Fatal(err)
 	}
-	count := 0
-	for sum, paths := range duplicates {
-		if len(paths) > 1 {
-			fmt.Printf("[%s]: %s\n", sum, strings.Join(paths, ", "))
-			count++
-		}
+	for _, g := range groups {
+		fmt.Printf("[%s]: %s\n", g.Digest, strings.Join(g.Paths, ", "))
 	}
-	if count == 0 {
-		fmt.Println(`no dupliactes found`)
+	if len(groups) == 0 {
+		fmt.Println(`no duplicates found`)
+		return
 	}
+	fmt.Printf("%d bytes wasted\n", dupes.TotalWasted(groups))
 }
@@ -0,0 +1,255 @@
+package checksum
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// pattern is a compiled gitignore-style pattern
+type pattern struct {
+	re      *regexp.Regexp
+	negate  bool // pattern starts with "!"
+	dirOnly bool // pattern ends with "/"
+}
+
+// compilePattern compiles a gitignore-style pattern. Patterns without a
+// slash (other than a trailing slash) match names at any depth; other
+// patterns are anchored to the base directory. "*" and "?" don't match "/",
+// and "**" matches any number of directories.
+func compilePattern(p string) (*pattern, error) {
+	pat := &pattern{}
+	if strings.HasPrefix(p, "!") {
+		pat.negate = true
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		pat.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if p == "" {
+		return nil, fmt.Errorf("invalid pattern: %q", p)
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	if strings.HasPrefix(p, "/") {
+		p = p[1:]
+	} else if !strings.Contains(p, "/") {
+		expr.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case strings.HasPrefix(p[i:], "**/") && (i == 0 || p[i-1] == '/'):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case p[i:] == "**" && i > 0 && p[i-1] == '/':
+			expr.WriteString(".*")
+			i++
+		case strings.HasPrefix(p[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid pattern: unclosed '[' in %q", p)
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(p):
+			i++
+			expr.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+	}
+	pat.re = re
+	return pat, nil
+}
+
+// match returns true if the pattern matches name, a slash-separated path
+// relative to the pattern's base directory.
+func (p *pattern) match(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return p.re.MatchString(name)
+}
+
+func compilePatterns(patterns []string) ([]*pattern, error) {
+	compiled := make([]*pattern, 0, len(patterns))
+	for _, p := range patterns {
+		pat, err := compilePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, pat)
+	}
+	return compiled, nil
+}
+
+// parseIgnoreFile parses the contents of a .gitignore-style file. Blank
+// lines and lines starting with "#" are ignored.
+func parseIgnoreFile(content []byte) ([]*pattern, error) {
+	var patterns []*pattern
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pat, err := compilePattern(line)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pat)
+	}
+	return patterns, scanner.Err()
+}
+
+// walkFilter applies include, exclude, and ignore file patterns from a
+// Config to a walk.
+type walkFilter struct {
+	fsys        fs.FS
+	root        string
+	includes    []*pattern
+	excludes    []*pattern
+	ignoreFiles []string
+	ignores     map[string][]*pattern // ignore file patterns by directory
+}
+
+// newWalkFilter returns a walkFilter for the Config, or nil if the Config
+// doesn't include any filters.
+func newWalkFilter(fsys fs.FS, root string, conf *Config) (*walkFilter, error) {
+	if len(conf.includes) == 0 && len(conf.excludes) == 0 && len(conf.ignoreFiles) == 0 {
+		return nil, nil
+	}
+	f := &walkFilter{
+		fsys:        fsys,
+		root:        root,
+		ignoreFiles: conf.ignoreFiles,
+		ignores:     make(map[string][]*pattern),
+	}
+	var err error
+	if f.includes, err = compilePatterns(conf.includes); err != nil {
+		return nil, err
+	}
+	if f.excludes, err = compilePatterns(conf.excludes); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// wrap returns a WalkDirFunc that applies the filter before calling walk.
+// Excluded directories are skipped and excluded files are not passed to
+// walk.
+func (f *walkFilter) wrap(walk fs.WalkDirFunc) fs.WalkDirFunc {
+	if f == nil {
+		return walk
+	}
+	return func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == f.root {
+			if err == nil && d.IsDir() {
+				if err := f.loadIgnores(name); err != nil {
+					return err
+				}
+			}
+			return walk(name, d, err)
+		}
+		if f.skip(name, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if err := f.loadIgnores(name); err != nil {
+				return err
+			}
+		}
+		return walk(name, d, err)
+	}
+}
+
+// skip returns true if name should be excluded from the walk
+func (f *walkFilter) skip(name string, isDir bool) bool {
+	rel := name
+	if f.root != "." {
+		rel = strings.TrimPrefix(name, f.root+"/")
+	}
+	for _, p := range f.excludes {
+		if !p.negate && p.match(rel, isDir) {
+			return true
+		}
+	}
+	if len(f.ignoreFiles) > 0 {
+		// ignore files in deeper directories take precedence, and later
+		// patterns take precedence over earlier ones.
+		var dirs []string
+		for dir := path.Dir(name); ; dir = path.Dir(dir) {
+			dirs = append(dirs, dir)
+			if dir == f.root || dir == "." {
+				break
+			}
+		}
+		ignored := false
+		for i := len(dirs) - 1; i >= 0; i-- {
+			dirRel := name
+			if dirs[i] != "." {
+				dirRel = strings.TrimPrefix(name, dirs[i]+"/")
+			}
+			for _, p := range f.ignores[dirs[i]] {
+				if p.match(dirRel, isDir) {
+					ignored = !p.negate
+				}
+			}
+		}
+		if ignored {
+			return true
+		}
+	}
+	if !isDir && len(f.includes) > 0 {
+		for _, p := range f.includes {
+			if p.match(rel, false) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// loadIgnores reads ignore files in dir
+func (f *walkFilter) loadIgnores(dir string) error {
+	for _, name := range f.ignoreFiles {
+		content, err := fs.ReadFile(f.fsys, path.Join(dir, name))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		patterns, err := parseIgnoreFile(content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path.Join(dir, name), err)
+		}
+		f.ignores[dir] = append(f.ignores[dir], patterns...)
+	}
+	return nil
+}
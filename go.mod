@@ -1,3 +1,13 @@
 module github.com/srerickson/checksum
 
-go 1.16
+go 1.22
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/zeebo/xxh3 v1.1.0
+	golang.org/x/crypto v0.33.0
+	golang.org/x/sys v0.30.0
+	lukechampine.com/blake3 v1.4.1
+)
+
+require github.com/klauspost/cpuid/v2 v2.2.10 // indirect
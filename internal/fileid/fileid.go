@@ -0,0 +1,21 @@
+// Package fileid identifies files by device and inode number where the
+// platform supports it.
+package fileid
+
+import "io/fs"
+
+// ID uniquely identifies a file on a system
+type ID struct {
+	Dev uint64
+	Ino uint64
+}
+
+// FromInfo returns the ID for the file described by info. The boolean is
+// false if info does not include device and inode numbers (e.g., on windows
+// or for files from an fs.FS not backed by the operating system).
+func FromInfo(info fs.FileInfo) (ID, bool) {
+	if info == nil {
+		return ID{}, false
+	}
+	return fromSys(info.Sys())
+}
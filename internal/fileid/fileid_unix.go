@@ -0,0 +1,14 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package fileid
+
+import "syscall"
+
+func fromSys(sys interface{}) (ID, bool) {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return ID{}, false
+	}
+	return ID{Dev: uint64(st.Dev), Ino: uint64(st.Ino)}, true
+}
@@ -1,30 +1,75 @@
 package checksum
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"hash"
 	"io"
 	"io/fs"
+	"sync/atomic"
 )
 
 var ErrNotRegularFile = errors.New(`not a regular file`)
 
+// ErrFileChanged is returned when a file's size or modification time changes
+// while it is being checksummed.
+var ErrFileChanged = errors.New(`file changed during checksum`)
+
 // Job is value streamed to/from Walk and Pool
 type Job struct {
-	path string                      // path to file
-	algs map[string]func() hash.Hash // hash constructor function
-	sums map[string][]byte           // checksum result
-	err  error                       // any encountered errors
-	fs   fs.FS
+	path   string              // path to file (or reader id)
+	reader io.Reader           // alternative to path
+	algs   map[string]*algFunc // hash constructor function
+	sums   map[string][]byte   // checksum result
+	err    error               // any encountered errors
+	info   fs.FileInfo         // file info from before checksum
+	fs     fs.FS
+	seq    int // order added, for ordered walks
+	// cache of previous checksums
+	cache   *Cache
+	cached  bool // sums are from cache
+	resumed bool // sums are from checkpoint journal
+	// progress counters
+	stats *pipeStats
+	size  int64 // expected size, for stats
+	read  int64 // bytes read, for stats
+	// concurrent chunk hashing for large files
+	splitSize int64
+	helpers   chan *splitTask // the Pipe's idle workers
+	// rate limiting
+	ctx      context.Context
+	throttle *Throttle
+	// symlink jobs (SymlinkReport)
+	symlink bool
+	target  string
 }
 
-// do does the job
-func (j *Job) do() {
-	if j.err != nil {
+// do does the job using the worker's buffer and hashes. If w is nil, new
+// ones are allocated.
+func (j *Job) do(w *worker) {
+	if w == nil {
+		w = newWorker(0)
+	}
+	if j.stats != nil {
+		defer func() { j.stats.done(j.size, j.read) }()
+	}
+	if j.err != nil || j.resumed {
 		return
 	}
+	if j.reader != nil {
+		j.sums, j.err = j.readerSums(w)
+		return
+	}
+	if j.symlink {
+		j.target, j.err = readLink(j.fs, j.path)
+		return
+	}
+	if j.throttle != nil {
+		if j.err = j.throttle.waitOpen(j.ctx); j.err != nil {
+			return
+		}
+	}
 	var file fs.File
 	file, j.err = j.fs.Open(j.path)
 	if j.err != nil {
@@ -36,33 +81,113 @@ func (j *Job) do() {
 	if j.err != nil {
 		return
 	}
+	j.info = info
+	if j.stats != nil {
+		atomic.AddInt64(&j.stats.bytesQueued, info.Size()-j.size)
+		j.size = info.Size()
+	}
 	if !info.Mode().IsRegular() {
 		j.err = fmt.Errorf(`cannot checksum %s: %w`, j.path, ErrNotRegularFile)
 		return
 	}
-	var hashes = make(map[string]hash.Hash)
-	var writers []io.Writer
-	for name, newHash := range j.algs {
-		h := newHash()
-		hashes[name] = h
-		writers = append(writers, io.Writer(h))
+	if j.cache != nil {
+		if sums := j.cache.get(j.path, info, j.algNames()); sums != nil {
+			j.sums = sums
+			j.cached = true
+			return
+		}
+	}
+	var sums map[string][]byte
+	if ra, ok := file.(io.ReaderAt); ok && j.splitSize > 0 && info.Size() >= j.splitSize {
+		sums, j.err = j.splitSums(w, ra, info.Size())
+	}
+	if sums == nil && j.err == nil {
+		sums, j.err = w.readSums(j, file)
 	}
-	multi := io.MultiWriter(writers...)
-	_, j.err = io.Copy(multi, file)
 	if j.err != nil {
 		return
 	}
-	j.sums = make(map[string][]byte)
-	for name, h := range hashes {
-		j.sums[name] = h.Sum(nil)
+	after, err := file.Stat()
+	if err != nil {
+		j.err = err
+		return
+	}
+	if after.Size() != info.Size() || !after.ModTime().Equal(info.ModTime()) {
+		j.err = fmt.Errorf(`cannot checksum %s: %w`, j.path, ErrFileChanged)
+		return
+	}
+	j.sums = sums
+	if j.cache != nil {
+		j.cache.set(j.path, info, j.sums)
 	}
 }
 
-// Path returns the Job's path
+// algNames returns the names of the Job's algorithms
+func (j *Job) algNames() []string {
+	names := make([]string, 0, len(j.algs))
+	for name := range j.algs {
+		names = append(names, name)
+	}
+	return names
+}
+
+// sizedReaderAt is implemented by io.SectionReader, bytes.Reader, and
+// strings.Reader
+type sizedReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// readerSums returns checksums for the Job's reader.
+func (j *Job) readerSums(w *worker) (map[string][]byte, error) {
+	if ra, ok := j.reader.(sizedReaderAt); ok {
+		if j.stats != nil {
+			atomic.AddInt64(&j.stats.bytesQueued, ra.Size()-j.size)
+			j.size = ra.Size()
+		}
+		if j.splitSize > 0 && ra.Size() >= j.splitSize {
+			sums, err := j.splitSums(w, ra, ra.Size())
+			if sums != nil || err != nil {
+				return sums, err
+			}
+		}
+	}
+	return w.readSums(j, j.reader)
+}
+
+// Path returns the Job's path, or the id for jobs added with AddReader().
 func (j Job) Path() string {
 	return j.path
 }
 
+// Info returns the fs.FileInfo for the Job's file, as reported by Stat()
+// before the file was read. It returns nil if the file could not be opened or
+// if the job was added with AddReader(). For symlink jobs, it describes the
+// link itself.
+func (j Job) Info() fs.FileInfo {
+	return j.info
+}
+
+// Cached returns true if the Job's checksums were taken from the Cache set
+// with WithCache() rather than calculated from the file's contents.
+func (j Job) Cached() bool {
+	return j.cached
+}
+
+// Resumed returns true if the Job's checksums were taken from the checkpoint
+// journal of a previous Walk (see WithCheckpoint()) rather than calculated
+// from the file's contents.
+func (j Job) Resumed() bool {
+	return j.resumed
+}
+
+// Symlink returns the target of a symlink and true if the Job is for a
+// symlink reported by Walk() with SymlinkReport. Symlink jobs have no
+// checksums.
+func (j Job) Symlink() (string, bool) {
+	return j.target, j.symlink
+}
+
 // Sum returns the checksum for the named algorithm. The package defines common
 // algorithm names (MD5, SHA256, etc.), otherwise name refers to the string
 // passed to WithAlg().
@@ -0,0 +1,106 @@
+package manifest
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/delta"
+)
+
+// bsdEncodings are the digest encodings tried for BSD-style lines. Digests
+// only decode with an encoding if they have the algorithm's size.
+var bsdEncodings = []checksum.Encoding{
+	checksum.Hex,
+	checksum.SRI,
+	checksum.Multihash,
+	checksum.Base64,
+	checksum.Base64URL,
+	checksum.Base32,
+}
+
+// parseBSDLine parses a line in the tagged format used by BSD md5 and by
+// coreutils with --tag: the algorithm name, the path in parentheses, " = ",
+// and the digest (e.g., "SHA256 (a.txt) = 2cf2...").
+func parseBSDLine(line string) (alg, digest, path string, err error) {
+	open := strings.Index(line, " (")
+	sep := strings.LastIndex(line, ") = ")
+	if open < 1 || sep < open {
+		return "", "", "", fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+	return line[:open], line[sep+len(") = "):], line[open+len(" (") : sep], nil
+}
+
+// ReadBSD reads a checksum file with BSD-style lines (see parseBSDLine()). It
+// returns a FileSet for each algorithm in the file, keyed by the
+// algorithm's canonical name (see checksum.Lookup()). Digests may use any
+// checksum.Encoding and are returned as lower case hex. Blank lines are
+// ignored. It returns an error if a path is listed more than once for an
+// algorithm.
+func ReadBSD(r io.Reader) (map[string]delta.FileSet, error) {
+	sets := map[string]delta.FileSet{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	var num int
+	for scanner.Scan() {
+		num++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		name, encoded, path, err := parseBSDLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", num, err)
+		}
+		alg, err := checksum.Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", num, err)
+		}
+		digest, err := decodeDigest(alg, encoded)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", num, err)
+		}
+		files := sets[alg.Name]
+		if files == nil {
+			files = delta.FileSet{}
+			sets[alg.Name] = files
+		}
+		if _, exists := files[path]; exists {
+			return nil, fmt.Errorf("line %d: duplicate path %q", num, path)
+		}
+		files[path] = digest
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// decodeDigest returns the hex digest for s, a digest for alg in any of
+// bsdEncodings.
+func decodeDigest(alg checksum.Algorithm, s string) (string, error) {
+	for _, enc := range bsdEncodings {
+		name, sum, err := enc.Decode(s)
+		if err != nil || len(sum) != alg.Size || (name != "" && name != alg.Name) {
+			continue
+		}
+		return hex.EncodeToString(sum), nil
+	}
+	return "", fmt.Errorf("%w: %q", checksum.ErrInvalidDigest, s)
+}
+
+// isBSD returns true if the first non-blank line in br is a BSD-style line
+// for a registered algorithm.
+func isBSD(br *bufio.Reader) bool {
+	b, _ := br.Peek(br.Size())
+	line, _, _ := strings.Cut(strings.TrimLeft(string(b), "\r\n"), "\n")
+	name, _, _, err := parseBSDLine(strings.TrimSuffix(line, "\r"))
+	if err != nil {
+		return false
+	}
+	_, err = checksum.Lookup(name)
+	return err == nil
+}
@@ -0,0 +1,217 @@
+package manifest
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/delta"
+)
+
+// digestLengthAlgs are the algorithms guessed from hex digest lengths, in
+// order of preference for ambiguous lengths.
+var digestLengthAlgs = []string{
+	checksum.MD5,
+	checksum.SHA1,
+	checksum.SHA256,
+	checksum.SHA384,
+	checksum.SHA512,
+}
+
+// strongestAlgs are algorithms in order of preference (strongest first) for
+// JSON checksum files with several algorithms. Other registered algorithms
+// are less preferred.
+var strongestAlgs = []string{
+	checksum.SHA512,
+	checksum.SHA3_512,
+	checksum.BLAKE2B512,
+	checksum.SHA384,
+	checksum.SHA3_256,
+	checksum.BLAKE3,
+	checksum.SHA256,
+	checksum.SHA256Tree,
+	checksum.SHA1,
+	checksum.MD5,
+}
+
+// GuessAlg returns the algorithm for the checksum file with the given name
+// and contents. The algorithm is taken from the file name if possible: its
+// extension (e.g., "files.sha256"), a coreutils-style name (e.g.,
+// "SHA256SUMS"), or a BagIt manifest name (e.g., "manifest-sha256.txt").
+// Otherwise, it is guessed from the length of the digests in files: md5,
+// sha1, sha256, sha384, or sha512. The returned name is the algorithm's
+// canonical name (see checksum.Lookup()).
+func GuessAlg(name string, files delta.FileSet) (string, error) {
+	base := strings.ToLower(filepath.Base(name))
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	candidates := []string{
+		strings.TrimPrefix(ext, "."),
+		strings.TrimSuffix(strings.TrimSuffix(base, "sums"), "sum"),
+		strings.TrimPrefix(strings.TrimPrefix(stem, "tag"), "manifest-"),
+	}
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		if alg, err := checksum.Lookup(c); err == nil {
+			return alg.Name, nil
+		}
+	}
+	var digest string
+	for _, digest = range files {
+		break // any digest will do
+	}
+	for _, n := range digestLengthAlgs {
+		if alg, err := checksum.Lookup(n); err == nil && alg.Size*2 == len(digest) {
+			return alg.Name, nil
+		}
+	}
+	return "", fmt.Errorf("can't determine the algorithm for %s", name)
+}
+
+// Diff returns the changes to the files under root in fsys since the
+// checksum file with the given name was created. The checksum file is read
+// with ReadFile(), which chooses the algorithm. Paths in the checksum file are
+// relative to root. Optional arguments are passed to
+// checksum.Walk(). If the checksum file is one of the walked files (e.g.,
+// with os.DirFS()), it is not included in the changes. An error checksumming
+// any file is returned.
+func Diff(fsys fs.FS, root string, name string, opts ...func(*checksum.Config)) (*delta.Delta, error) {
+	saved, alg, err := ReadFile(name, "")
+	if err != nil {
+		return nil, err
+	}
+	a, err := checksum.Lookup(alg)
+	if err != nil {
+		return nil, err
+	}
+	self, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	current := delta.FileSet{}
+	each := func(job checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		if info := job.Info(); info != nil && os.SameFile(self, info) {
+			return nil // the checksum file
+		}
+		sum, err := job.SumString(alg)
+		if err != nil {
+			return err
+		}
+		p := job.Path()
+		if root != "." {
+			p = strings.TrimPrefix(p, root+"/")
+		}
+		current[p] = sum
+		return nil
+	}
+	opts = append(opts[:len(opts):len(opts)], checksum.WithAlg(alg, a.New))
+	if err := checksum.Walk(fsys, root, each, opts...); err != nil {
+		return nil, err
+	}
+	return delta.New(saved, current), nil
+}
+
+// ReadFile reads the named checksum file and returns its digests for alg and
+// the algorithm's canonical name. The file's format is detected from its
+// contents: JSON or JSON Lines (see ReadJSON()), BSD-style lines (see
+// ReadBSD()), or the format read by Read(). If alg is empty, the algorithm is
+// the strongest of the file's registered algorithms or, for files read with
+// Read(), is chosen with GuessAlg(). Digests are returned in lower case.
+func ReadFile(name string, alg string) (delta.FileSet, string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var sets map[string]delta.FileSet
+	switch {
+	case isJSON(br):
+		sets, err = ReadJSON(br)
+	case isBSD(br):
+		sets, err = ReadBSD(br)
+	default:
+		var files delta.FileSet
+		if files, err = Read(br); err != nil {
+			break
+		}
+		if alg == "" {
+			if alg, err = GuessAlg(name, files); err != nil {
+				return nil, "", err
+			}
+		}
+		sets = map[string]delta.FileSet{alg: files}
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", name, err)
+	}
+	files, alg := selectAlg(sets, alg)
+	if files == nil {
+		return nil, "", fmt.Errorf("%s: no supported algorithms", name)
+	}
+	for p, digest := range files {
+		files[p] = strings.ToLower(digest) // to match Job.SumString()
+	}
+	return files, alg, nil
+}
+
+// selectAlg returns the FileSet in sets for alg and the algorithm's canonical
+// name. If alg is empty, the strongest algorithm is used. It returns nil if
+// there isn't a FileSet for a registered algorithm.
+func selectAlg(sets map[string]delta.FileSet, alg string) (delta.FileSet, string) {
+	if alg == "" {
+		alg = strongest(sets)
+	}
+	a, err := checksum.Lookup(alg)
+	if err != nil {
+		return nil, ""
+	}
+	for name, files := range sets {
+		if b, err := checksum.Lookup(name); err == nil && b.Name == a.Name {
+			return files, a.Name
+		}
+	}
+	return nil, ""
+}
+
+// strongest returns the registered algorithm in sets that is first in
+// strongestAlgs, or the first in lexical order if none are. It returns "" if
+// no algorithms are registered.
+func strongest(sets map[string]delta.FileSet) string {
+	algs := make([]string, 0, len(sets))
+	for alg := range sets {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	rank := func(alg string) int {
+		a, err := checksum.Lookup(alg)
+		if err != nil {
+			return -1
+		}
+		for i, name := range strongestAlgs {
+			if a.Name == name {
+				return i
+			}
+		}
+		return len(strongestAlgs)
+	}
+	best, bestRank := "", -1
+	for _, alg := range algs {
+		r := rank(alg)
+		if r >= 0 && (bestRank < 0 || r < bestRank) {
+			best, bestRank = alg, r
+		}
+	}
+	return best
+}
@@ -0,0 +1,186 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/delta"
+)
+
+// Record is the JSON representation of a completed checksum.Job used by
+// JSONWriter and ReadJSON().
+type Record struct {
+	Path    string            `json:"path"`
+	Size    *int64            `json:"size,omitempty"`
+	ModTime *time.Time        `json:"mtime,omitempty"`
+	Digests map[string]string `json:"digests,omitempty"` // algorithm -> hex digest
+	Error   string            `json:"error,omitempty"`
+}
+
+// NewRecord returns the Record for job. The size and modification time are
+// from job.Info() and are omitted if it is nil (e.g., for jobs added with
+// AddReader()).
+func NewRecord(job checksum.Job) Record {
+	rec := Record{Path: job.Path()}
+	if info := job.Info(); info != nil {
+		size, mtime := info.Size(), info.ModTime().UTC()
+		rec.Size, rec.ModTime = &size, &mtime
+	}
+	if err := job.Err(); err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+	if sums := job.Sums(); len(sums) > 0 {
+		rec.Digests = make(map[string]string, len(sums))
+		for alg := range sums {
+			if digest, err := job.SumString(alg); err == nil {
+				rec.Digests[alg] = digest
+			}
+		}
+	}
+	return rec
+}
+
+// JSONWriter writes a Record for each Job completed by checksum.Walk() or a
+// checksum.Pipe, either as JSON Lines (one record per line) or as a single
+// JSON array.
+type JSONWriter struct {
+	mx    sync.Mutex
+	w     io.Writer
+	array bool
+	count int
+}
+
+// NewJSONLinesWriter returns a JSONWriter that writes records to w as JSON
+// Lines.
+func NewJSONLinesWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{w: w}
+}
+
+// NewJSONWriter returns a JSONWriter that writes records to w as elements of
+// a JSON array. Close() must be called to end the array.
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{w: w, array: true}
+}
+
+// Write writes the record for job, including jobs with errors. It is safe to
+// call Write from multiple go routines.
+func (w *JSONWriter) Write(job checksum.Job) error {
+	b, err := json.Marshal(NewRecord(job))
+	if err != nil {
+		return fmt.Errorf("%s: %w", job.Path(), err)
+	}
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	w.count++
+	if !w.array {
+		_, err = io.WriteString(w.w, string(b)+"\n")
+		return err
+	}
+	// array elements are terminated by the next element or by Close()
+	sep := ",\n"
+	if w.count == 1 {
+		sep = "[\n"
+	}
+	_, err = io.WriteString(w.w, sep+string(b))
+	return err
+}
+
+// Close ends the JSON array for writers created with NewJSONWriter(). It
+// doesn't close the underlying io.Writer.
+func (w *JSONWriter) Close() error {
+	if !w.array {
+		return nil
+	}
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	end := "\n]\n"
+	if w.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.w, end)
+	return err
+}
+
+// JobFunc returns a checksum.JobFunc that writes every job to w. Unlike
+// Writer.JobFunc(), jobs with errors are written (with the error message)
+// rather than stopping the walk.
+func (w *JSONWriter) JobFunc() checksum.JobFunc {
+	return func(job checksum.Job, _ error) error {
+		return w.Write(job)
+	}
+}
+
+// ReadJSON reads records written by a JSONWriter, either as JSON Lines or as
+// a JSON array. It returns a FileSet (paths to digests) for each algorithm
+// in the records. Records with errors are skipped.
+func ReadJSON(r io.Reader) (map[string]delta.FileSet, error) {
+	br := bufio.NewReader(r)
+	dec := json.NewDecoder(br)
+	sets := map[string]delta.FileSet{}
+	add := func(rec Record) {
+		if rec.Error != "" {
+			return
+		}
+		for alg, digest := range rec.Digests {
+			if sets[alg] == nil {
+				sets[alg] = delta.FileSet{}
+			}
+			sets[alg][rec.Path] = digest
+		}
+	}
+	if isArray(br) {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		for dec.More() {
+			var rec Record
+			if err := dec.Decode(&rec); err != nil {
+				return nil, err
+			}
+			add(rec)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return sets, nil
+	}
+	for {
+		var rec Record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return sets, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		add(rec)
+	}
+}
+
+// isJSON returns true if the first non-space byte in br starts a JSON array
+// or object.
+func isJSON(br *bufio.Reader) bool {
+	b, _ := br.Peek(br.Size())
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) > 0 && (b[0] == '[' || b[0] == '{')
+}
+
+// isArray returns true if the first non-space byte in br is '['
+func isArray(br *bufio.Reader) bool {
+	for i := 1; ; i++ {
+		b, err := br.Peek(i)
+		if err != nil || len(b) < i {
+			return false
+		}
+		if c := b[i-1]; !bytes.ContainsRune([]byte(" \t\r\n"), rune(c)) {
+			return c == '['
+		}
+	}
+}
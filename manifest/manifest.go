@@ -0,0 +1,188 @@
+// Package manifest reads and writes checksum files in the format produced by
+// GNU coreutils (md5sum, sha1sum, sha256sum, etc.). It also reads and writes
+// checksum results as JSON or JSON Lines, and reads BSD-style checksum files.
+package manifest
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/delta"
+)
+
+// ErrInvalidLine is returned when a line in a checksum file can't be parsed.
+var ErrInvalidLine = errors.New(`invalid checksum line`)
+
+// FormatLine returns a single line (without the trailing newline) in the
+// format used by sha256sum and friends: the hex digest, a space, a mode
+// character ('*' for binary, ' ' for text), and the path. If path includes a
+// backslash, newline, or carriage return, the path is escaped and the line is
+// prefixed with a backslash, as in coreutils.
+func FormatLine(digest, path string, binary bool) string {
+	mode := ' '
+	if binary {
+		mode = '*'
+	}
+	var prefix string
+	if strings.ContainsAny(path, "\\\n\r") {
+		prefix = `\`
+		path = escaper.Replace(path)
+	}
+	return fmt.Sprintf("%s%s %c%s", prefix, digest, mode, path)
+}
+
+// ParseLine parses a single line from a checksum file. The trailing newline,
+// if present, is ignored.
+func ParseLine(line string) (digest, path string, binary bool, err error) {
+	line = strings.TrimSuffix(line, "\n")
+	escaped := strings.HasPrefix(line, `\`)
+	if escaped {
+		line = line[1:]
+	}
+	i := strings.IndexByte(line, ' ')
+	if i < 1 || i+2 > len(line) {
+		return "", "", false, fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+	digest = line[:i]
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", "", false, fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+	switch line[i+1] {
+	case '*':
+		binary = true
+	case ' ':
+	default:
+		return "", "", false, fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+	path = line[i+2:]
+	if path == "" {
+		return "", "", false, fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+	if escaped {
+		if path, err = unescape(path); err != nil {
+			return "", "", false, err
+		}
+	}
+	return strings.ToLower(digest), path, binary, nil
+}
+
+// Read parses a checksum file from r and returns its contents as a FileSet.
+// Blank lines are ignored. It returns an error if a path is listed more than
+// once.
+func Read(r io.Reader) (delta.FileSet, error) {
+	files := make(delta.FileSet)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	var num int
+	for scanner.Scan() {
+		num++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		digest, path, _, err := ParseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", num, err)
+		}
+		if _, exists := files[path]; exists {
+			return nil, fmt.Errorf("line %d: duplicate path %q", num, path)
+		}
+		files[path] = digest
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Write writes files to w in checksum file format, sorted by path. If binary
+// is true, entries are written with the '*' binary marker.
+func Write(w io.Writer, files delta.FileSet, binary bool) error {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	bw := bufio.NewWriter(w)
+	for _, p := range paths {
+		if _, err := bw.WriteString(FormatLine(files[p], p, binary) + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Writer writes checksum file entries for Jobs completed by checksum.Walk()
+// or a checksum.Pipe.
+type Writer struct {
+	// Binary sets the '*' binary marker on written lines.
+	Binary bool
+
+	alg string
+	mx  sync.Mutex
+	w   io.Writer
+}
+
+// NewWriter returns a new Writer that writes entries to w using digests for
+// the named algorithm.
+func NewWriter(w io.Writer, alg string) *Writer {
+	return &Writer{w: w, alg: alg}
+}
+
+// Write writes the entry for job. It returns an error if the job does not
+// include a digest for the Writer's algorithm. It is safe to call Write from
+// multiple go routines.
+func (w *Writer) Write(job checksum.Job) error {
+	sum, err := job.SumString(w.alg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", job.Path(), err)
+	}
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	_, err = io.WriteString(w.w, FormatLine(sum, job.Path(), w.Binary)+"\n")
+	return err
+}
+
+// JobFunc returns a checksum.JobFunc that writes each successful job to w.
+func (w *Writer) JobFunc() checksum.JobFunc {
+	return func(job checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		return w.Write(job)
+	}
+}
+
+var escaper = strings.NewReplacer("\\", `\\`, "\n", `\n`, "\r", `\r`)
+
+func unescape(path string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] != '\\' {
+			b.WriteByte(path[i])
+			continue
+		}
+		i++
+		if i == len(path) {
+			return "", fmt.Errorf("%w: trailing backslash in %q", ErrInvalidLine, path)
+		}
+		switch path[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			return "", fmt.Errorf("%w: invalid escape in %q", ErrInvalidLine, path)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,310 @@
+package manifest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/delta"
+	"github.com/srerickson/checksum/manifest"
+)
+
+func TestFormatParseLine(t *testing.T) {
+	table := []struct {
+		path   string
+		binary bool
+		line   string
+	}{
+		{"a/file.txt", false, "d41d8cd98f00b204e9800998ecf8427e  a/file.txt"},
+		{"a/file.txt", true, "d41d8cd98f00b204e9800998ecf8427e *a/file.txt"},
+		{"a\\b", false, "\\d41d8cd98f00b204e9800998ecf8427e  a\\\\b"},
+		{"new\nline", true, "\\d41d8cd98f00b204e9800998ecf8427e *new\\nline"},
+		{" leading space", false, "d41d8cd98f00b204e9800998ecf8427e   leading space"},
+	}
+	for _, row := range table {
+		line := manifest.FormatLine("d41d8cd98f00b204e9800998ecf8427e", row.path, row.binary)
+		if line != row.line {
+			t.Errorf("FormatLine(%q): expected %q, got %q", row.path, row.line, line)
+		}
+		_, path, binary, err := manifest.ParseLine(line)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if path != row.path || binary != row.binary {
+			t.Errorf("ParseLine(%q): got path %q, binary %v", line, path, binary)
+		}
+	}
+	for _, bad := range []string{"", "abc", "xyz  file", "abc\tfile", "\\abc  bad\\q"} {
+		if _, _, _, err := manifest.ParseLine(bad); err == nil {
+			t.Errorf("ParseLine(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestWalkWriteRead(t *testing.T) {
+	var buf bytes.Buffer
+	w := manifest.NewWriter(&buf, checksum.MD5)
+	err := checksum.Walk(os.DirFS("../test/fixture"), ".", w.JobFunc(), checksum.WithMD5())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := manifest.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Errorf("expected 4 files, got %d", len(files))
+	}
+	if files["hello.csv"] != "9d02fa6e9dd9f38327f7b213daa28be6" {
+		t.Errorf("unexpected digest for hello.csv: %q", files["hello.csv"])
+	}
+
+	// round trip a sorted manifest with odd names
+	files = delta.FileSet{
+		"b\\c":     "9d02fa6e9dd9f38327f7b213daa28be6",
+		"a\nb":     "d41d8cd98f00b204e9800998ecf8427e",
+		"z y x.md": "e8c078f0e4ad79b16fcb618a3790c2df",
+	}
+	buf.Reset()
+	if err := manifest.Write(&buf, files, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "\\d41d8cd98f00b204e9800998ecf8427e  a\\nb\n") {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+	got, err := manifest.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(files) {
+		t.Fatalf("expected %d entries, got %d", len(files), len(got))
+	}
+	for p, d := range files {
+		if got[p] != d {
+			t.Errorf("expected %s for %q, got %q", d, p, got[p])
+		}
+	}
+	if _, err := manifest.Read(strings.NewReader("abcd  a\nabcd  a\n")); err == nil {
+		t.Error("expected an error for duplicate paths")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	fsys := os.DirFS("../test/fixture")
+	for _, array := range []bool{false, true} {
+		var buf bytes.Buffer
+		w := manifest.NewJSONLinesWriter(&buf)
+		if array {
+			w = manifest.NewJSONWriter(&buf)
+		}
+		err := checksum.Walk(fsys, ".", w.JobFunc(), checksum.WithMD5(), checksum.WithSHA1())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a failed job is included with its error
+		pipe, err := checksum.NewPipe(fsys, checksum.WithMD5())
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			defer pipe.Close()
+			pipe.Add("missing.txt")
+		}()
+		for j := range pipe.Out() {
+			if err := w.Write(j); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if array && !json.Valid(buf.Bytes()) {
+			t.Fatalf("invalid JSON: %s", buf.String())
+		}
+		if !array && !strings.Contains(buf.String(), `"path":"missing.txt","error":`) {
+			t.Errorf("missing error record in %s", buf.String())
+		}
+		sets, err := manifest.ReadJSON(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sets) != 2 || len(sets[checksum.MD5]) != 4 || len(sets[checksum.SHA1]) != 4 {
+			t.Fatalf("unexpected result: %v", sets)
+		}
+		if d := sets[checksum.MD5]["hello.csv"]; d != "9d02fa6e9dd9f38327f7b213daa28be6" {
+			t.Errorf("unexpected digest for hello.csv: %q", d)
+		}
+	}
+	var rec manifest.Record
+	var buf bytes.Buffer
+	err := checksum.Walk(os.DirFS("../test/fixture"), "hello.csv", manifest.NewJSONLinesWriter(&buf).JobFunc(), checksum.WithMD5())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Size == nil || *rec.Size != 15 || rec.ModTime == nil || rec.Digests[checksum.MD5] == "" {
+		t.Errorf("unexpected record: %s", buf.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	fsys := os.DirFS("../test")
+	saved := delta.FileSet{
+		"hello.csv":             "9d02fa6e9dd9f38327f7b213daa28be6",
+		"folder1/file.txt":      "d41d8cd98f00b204e9800998ecf8427e",
+		"folder1/old-file2.txt": "d41d8cd98f00b204e9800998ecf8427e", // renamed
+		"folder1/folder2/sculpture-stone-face-head-888027.jpg": "00000000000000000000000000000000", // modified
+		"removed.txt": "11111111111111111111111111111111",
+	}
+	dir := t.TempDir()
+	// the algorithm is from the digest length
+	name := filepath.Join(dir, "saved.txt")
+	var buf bytes.Buffer
+	if err := manifest.Write(&buf, saved, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := manifest.Diff(fsys, "fixture", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := d.Report().Summary
+	if (s != delta.Summary{Modified: 1, Renamed: 1, Removed: 1, Unchanged: 2}) {
+		t.Errorf("unexpected changes: %+v", s)
+	}
+	// a sha1 manifest named by extension, for a walk of the whole FS
+	buf.Reset()
+	err = checksum.Walk(fsys, ".", manifest.NewWriter(&buf, checksum.SHA1).JobFunc(), checksum.WithSHA1())
+	if err != nil {
+		t.Fatal(err)
+	}
+	name = filepath.Join(dir, "test.SHA-1")
+	if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err = manifest.Diff(fsys, ".", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Report().Changed() {
+		t.Errorf("unexpected changes: %+v", d.Report().Summary)
+	}
+	// JSON with several algorithms: the strongest is used; digests may be
+	// upper case
+	buf.Reset()
+	each := func(j checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		rec := manifest.NewRecord(j)
+		rec.Digests[checksum.SHA256] = strings.ToUpper(rec.Digests[checksum.SHA256])
+		rec.Digests[checksum.MD5] = "00000000000000000000000000000000"
+		return json.NewEncoder(&buf).Encode(rec)
+	}
+	if err := checksum.Walk(fsys, ".", each, checksum.WithMD5(), checksum.WithSHA256()); err != nil {
+		t.Fatal(err)
+	}
+	name = filepath.Join(dir, "test.jsonl")
+	if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err = manifest.Diff(fsys, ".", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Report().Changed() {
+		t.Errorf("unexpected changes: %+v", d.Report().Summary)
+	}
+	// the checksum file is in the walked directory
+	tree := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tree, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	err = checksum.Walk(os.DirFS(tree), ".", manifest.NewWriter(&buf, checksum.MD5).JobFunc(), checksum.WithMD5())
+	if err != nil {
+		t.Fatal(err)
+	}
+	name = filepath.Join(tree, "manifest.md5")
+	if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err = manifest.Diff(os.DirFS(tree), ".", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Report().Changed() {
+		t.Errorf("unexpected changes: %+v", d.Report().Summary)
+	}
+	for name, want := range map[string]string{
+		"SHA512SUMS":          checksum.SHA512,
+		"manifest-sha256.txt": checksum.SHA256,
+		"files.blake3":        checksum.BLAKE3,
+	} {
+		if got, err := manifest.GuessAlg(name, nil); err != nil || got != want {
+			t.Errorf("GuessAlg(%q): expected %s, got %s, %v", name, want, got, err)
+		}
+	}
+	if _, err := manifest.GuessAlg("files.txt", delta.FileSet{"a": "abc"}); err == nil {
+		t.Error("expected an error for unknown algorithm")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	const md5 = "5d41402abc4b2a76b9719d911017c592"
+	const sha1 = "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"
+	files := map[string]string{
+		"gnu":  md5 + "  a.txt\n",
+		"bsd":  "MD5 (a.txt) = " + md5 + "\nSHA1 (a.txt) = qvTGHdzF6KLavt4PO0gs2a6pQ00=\n",
+		"json": `[{"path":"a.txt","digests":{"md5":"` + md5 + `","sha1":"` + strings.ToUpper(sha1) + `"}}]`,
+		"jsonl": `{"path":"a.txt","digests":{"md5":"` + md5 + `"}}` + "\n" +
+			`{"path":"b.txt","error":"failed"}` + "\n",
+	}
+	for format, content := range files {
+		name := filepath.Join(dir, format)
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, alg, err := manifest.ReadFile(name, "")
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		want := md5
+		if alg == checksum.SHA1 {
+			want = sha1
+		}
+		if len(got) != 1 || got["a.txt"] != want {
+			t.Errorf("%s: unexpected result: %s, %v", format, alg, got)
+		}
+		// the strongest algorithm is used unless one is given
+		if format == "bsd" || format == "json" {
+			if alg != checksum.SHA1 {
+				t.Errorf("%s: expected sha1, got %s", format, alg)
+			}
+			if got, alg, err := manifest.ReadFile(name, "MD5"); err != nil || alg != checksum.MD5 || got["a.txt"] != md5 {
+				t.Errorf("%s: unexpected result for md5: %s, %v, %v", format, alg, got, err)
+			}
+		}
+	}
+	if _, _, err := manifest.ReadFile(filepath.Join(dir, "jsonl"), checksum.SHA256); err == nil {
+		t.Error("expected an error for missing algorithm")
+	}
+	name := filepath.Join(dir, "bad")
+	if err := os.WriteFile(name, []byte("MD5 (a.txt) = abc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := manifest.ReadFile(name, ""); !errors.Is(err, checksum.ErrInvalidDigest) {
+		t.Errorf("expected ErrInvalidDigest, got %v", err)
+	}
+}
@@ -0,0 +1,456 @@
+// Package ocfl builds and validates Oxford Common File Layout (OCFL)
+// inventories using concurrent checksums from the checksum package.
+package ocfl
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/delta"
+)
+
+const (
+	// InventoryType is the type declared in inventories created by this package
+	InventoryType = `https://ocfl.io/1.1/spec/#inventory`
+	// InventoryFile is the name of the inventory file in object roots
+	InventoryFile = `inventory.json`
+
+	defaultContentDir = `content`
+)
+
+// digestAlgs are the algorithms allowed for the inventory's digestAlgorithm
+var digestAlgs = []string{checksum.SHA512, checksum.SHA256}
+
+// digestHash returns the hash constructor for the inventory digest algorithm
+// alg, which must be one of digestAlgs.
+func digestHash(alg string) (func() hash.Hash, bool) {
+	for _, name := range digestAlgs {
+		if alg == name {
+			a, err := checksum.Lookup(name)
+			return a.New, err == nil
+		}
+	}
+	return nil, false
+}
+
+// DigestMap maps digests to lists of paths. It is used for manifest, version
+// state, and fixity blocks.
+type DigestMap map[string][]string
+
+// FileSet returns the DigestMap inverted: as a map of paths to digests
+func (dm DigestMap) FileSet() delta.FileSet {
+	files := delta.FileSet{}
+	for dig, paths := range dm {
+		for _, p := range paths {
+			files[p] = dig
+		}
+	}
+	return files
+}
+
+// digestMap inverts files into a DigestMap with sorted paths
+func digestMap(files delta.FileSet) DigestMap {
+	dm := DigestMap{}
+	for p, dig := range files {
+		dm[dig] = append(dm[dig], p)
+	}
+	for _, paths := range dm {
+		sort.Strings(paths)
+	}
+	return dm
+}
+
+// User is the user block of a version
+type User struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+}
+
+// Version is an entry in the inventory's versions block
+type Version struct {
+	Created time.Time `json:"created"`
+	Message string    `json:"message,omitempty"`
+	User    *User     `json:"user,omitempty"`
+	State   DigestMap `json:"state"`
+}
+
+// Inventory represents an OCFL inventory.json file
+type Inventory struct {
+	ID               string               `json:"id"`
+	Type             string               `json:"type"`
+	DigestAlgorithm  string               `json:"digestAlgorithm"`
+	Head             string               `json:"head"`
+	ContentDirectory string               `json:"contentDirectory,omitempty"`
+	Manifest         DigestMap            `json:"manifest"`
+	Versions         map[string]*Version  `json:"versions"`
+	Fixity           map[string]DigestMap `json:"fixity,omitempty"`
+}
+
+// NewInventory returns a new Inventory with no versions. The digest algorithm
+// must be sha512 or sha256.
+func NewInventory(id string, alg string) (*Inventory, error) {
+	if _, ok := digestHash(alg); !ok {
+		return nil, fmt.Errorf("invalid OCFL digest algorithm: %s", alg)
+	}
+	return &Inventory{
+		ID:              id,
+		Type:            InventoryType,
+		DigestAlgorithm: alg,
+		Manifest:        DigestMap{},
+		Versions:        map[string]*Version{},
+	}, nil
+}
+
+// contentDir returns the inventory's content directory name
+func (inv *Inventory) contentDir() string {
+	if inv.ContentDirectory != "" {
+		return inv.ContentDirectory
+	}
+	return defaultContentDir
+}
+
+// VersionState returns the state of the version v as a FileSet (logical paths
+// to digests). It returns nil if the version does not exist.
+func (inv *Inventory) VersionState(v string) delta.FileSet {
+	ver := inv.Versions[v]
+	if ver == nil {
+		return nil
+	}
+	return ver.State.FileSet()
+}
+
+// AddVersion creates a new head version from the files under root in fsys.
+// The new version's state lists the logical path of each file (relative to
+// root) and its digest. Files with digests not already in the inventory
+// manifest are assigned content paths in the new version's content
+// directory. The returned map lists these new content paths (relative to the
+// object root) and the corresponding source path in fsys; the caller is
+// responsible for copying them. Digests for each named algorithm in fixity
+// are added to the inventory's fixity block for new content. The Created,
+// Message, and User fields of ver are used for the new version. Optional
+// arguments are passed to checksum.Walk().
+func (inv *Inventory) AddVersion(fsys fs.FS, root string, ver Version, fixity []string, opts ...func(*checksum.Config)) (map[string]string, error) {
+	newHash, ok := digestHash(inv.DigestAlgorithm)
+	if !ok {
+		return nil, fmt.Errorf("invalid OCFL digest algorithm: %s", inv.DigestAlgorithm)
+	}
+	opts = append([]func(*checksum.Config){}, opts...)
+	opts = append(opts, checksum.WithAlg(inv.DigestAlgorithm, newHash))
+	// fixity blocks use canonical names, e.g., "sha1" for "SHA-1"
+	fixityAlgs := make([]string, 0, len(fixity))
+	for _, alg := range fixity {
+		a, err := checksum.Lookup(alg)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported fixity algorithm: %w", err)
+		}
+		fixityAlgs = append(fixityAlgs, a.Name)
+		opts = append(opts, checksum.WithAlg(a.Name, a.New))
+	}
+	state := delta.FileSet{}
+	fixityDigests := map[string]map[string]string{} // logical path -> alg -> digest
+	each := func(j checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		logical := strings.TrimPrefix(j.Path(), root+"/")
+		if root == "." {
+			logical = j.Path()
+		}
+		sums := j.Sums()
+		state[logical] = hex.EncodeToString(sums[inv.DigestAlgorithm])
+		fixityDigests[logical] = map[string]string{}
+		for _, alg := range fixityAlgs {
+			fixityDigests[logical][alg] = hex.EncodeToString(sums[alg])
+		}
+		return nil
+	}
+	if err := checksum.Walk(fsys, root, each, opts...); err != nil {
+		return nil, err
+	}
+	head := versionName(1, 0)
+	var prev delta.FileSet
+	if inv.Head != "" {
+		num, err := versionNum(inv.Head)
+		if err != nil {
+			return nil, err
+		}
+		prev = inv.VersionState(inv.Head)
+		head = versionName(num+1, versionPadding(inv.Head))
+	}
+	if inv.Manifest == nil {
+		inv.Manifest = DigestMap{}
+	}
+	if inv.Versions == nil {
+		inv.Versions = map[string]*Version{}
+	}
+	// only digests that are new in this version may need new content
+	newContent := map[string]string{}
+	for dig, paths := range delta.New(prev, state).NewDigests() {
+		if _, exists := inv.Manifest[dig]; exists {
+			continue
+		}
+		sort.Strings(paths)
+		logical := paths[0]
+		content := path.Join(head, inv.contentDir(), logical)
+		inv.Manifest[dig] = []string{content}
+		src := logical
+		if root != "." {
+			src = path.Join(root, logical)
+		}
+		newContent[content] = src
+		for alg, fixDig := range fixityDigests[logical] {
+			if inv.Fixity == nil {
+				inv.Fixity = map[string]DigestMap{}
+			}
+			if inv.Fixity[alg] == nil {
+				inv.Fixity[alg] = DigestMap{}
+			}
+			inv.Fixity[alg][fixDig] = append(inv.Fixity[alg][fixDig], content)
+		}
+	}
+	ver.State = digestMap(state)
+	if ver.Created.IsZero() {
+		ver.Created = time.Now().UTC().Truncate(time.Second)
+	}
+	inv.Versions[head] = &ver
+	inv.Head = head
+	return newContent, nil
+}
+
+// ReadInventory reads and parses the inventory.json file in the root of fsys.
+func ReadInventory(fsys fs.FS) (*Inventory, error) {
+	b, err := fs.ReadFile(fsys, InventoryFile)
+	if err != nil {
+		return nil, err
+	}
+	var inv Inventory
+	if err := json.Unmarshal(b, &inv); err != nil {
+		return nil, fmt.Errorf("%s: %w", InventoryFile, err)
+	}
+	return &inv, nil
+}
+
+// WriteInventory writes inv as inventory.json in dir, along with the
+// inventory digest sidecar file (e.g., inventory.json.sha512).
+func WriteInventory(dir string, inv *Inventory) error {
+	newHash, ok := digestHash(inv.DigestAlgorithm)
+	if !ok {
+		return fmt.Errorf("invalid OCFL digest algorithm: %s", inv.DigestAlgorithm)
+	}
+	b, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+	h := newHash()
+	h.Write(b)
+	sidecar := hex.EncodeToString(h.Sum(nil)) + " " + InventoryFile + "\n"
+	if err := os.WriteFile(filepath.Join(dir, InventoryFile), b, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, InventoryFile+"."+inv.DigestAlgorithm), []byte(sidecar), 0644)
+}
+
+// Validate checks the OCFL object in the root of fsys. It reads the
+// inventory, verifies the inventory sidecar digest and inventory structure,
+// and checks that every content file in the object is in the manifest and
+// that manifest and fixity digests match the content. Optional arguments are
+// passed to checksum.Walk(). If the object is invalid, the returned error is
+// a *ValidationError.
+func Validate(fsys fs.FS, opts ...func(*checksum.Config)) error {
+	inv, err := ReadInventory(fsys)
+	if err != nil {
+		return err
+	}
+	verr := &ValidationError{}
+	newHash, ok := digestHash(inv.DigestAlgorithm)
+	if !ok {
+		verr.Errs = append(verr.Errs, fmt.Errorf("invalid digestAlgorithm: %s", inv.DigestAlgorithm))
+		return verr
+	}
+	if err := validateSidecar(fsys, inv.DigestAlgorithm, newHash); err != nil {
+		verr.Errs = append(verr.Errs, err)
+	}
+	verr.Errs = append(verr.Errs, inv.validateStructure()...)
+
+	// expected digests for each content path, by algorithm
+	expected := map[string]delta.FileSet{
+		inv.DigestAlgorithm: inv.Manifest.FileSet(),
+	}
+	opts = append([]func(*checksum.Config){}, opts...)
+	opts = append(opts, checksum.WithAlg(inv.DigestAlgorithm, newHash))
+	for alg, dm := range inv.Fixity {
+		if alg == inv.DigestAlgorithm {
+			continue
+		}
+		a, err := checksum.Lookup(alg)
+		if err != nil {
+			continue // unknown fixity algorithms are ignored
+		}
+		opts = append(opts, checksum.WithAlg(alg, a.New))
+		expected[alg] = dm.FileSet()
+	}
+	contentDir := inv.contentDir()
+	walkFunc := func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		parts := strings.SplitN(name, "/", 3)
+		if d.IsDir() && len(parts) == 2 && parts[1] != contentDir {
+			return fs.SkipDir // skip non-content directories in versions
+		}
+		if !d.Type().IsRegular() || len(parts) < 3 {
+			return checksum.ErrSkipFile
+		}
+		return nil
+	}
+	found := map[string]bool{}
+	each := func(j checksum.Job, err error) error {
+		if err != nil {
+			return err
+		}
+		found[j.Path()] = true
+		if _, ok := expected[inv.DigestAlgorithm][j.Path()]; !ok {
+			verr.Errs = append(verr.Errs, fmt.Errorf("%s: content file not in manifest", j.Path()))
+			return nil
+		}
+		for alg, files := range expected {
+			want, ok := files[j.Path()]
+			if !ok {
+				continue
+			}
+			got, err := j.SumString(alg)
+			if err != nil {
+				return err
+			}
+			if !strings.EqualFold(want, got) {
+				verr.Errs = append(verr.Errs, fmt.Errorf("%s: %s digest mismatch", j.Path(), alg))
+			}
+		}
+		return nil
+	}
+	opts = append(opts, checksum.WithWalkDirFunc(walkFunc))
+	for v := range inv.Versions {
+		if _, err := fs.Stat(fsys, v); err != nil {
+			continue
+		}
+		if err := checksum.Walk(fsys, v, each, opts...); err != nil {
+			return err
+		}
+	}
+	for p := range expected[inv.DigestAlgorithm] {
+		if !found[p] {
+			verr.Errs = append(verr.Errs, fmt.Errorf("%s: manifest content path not found", p))
+		}
+	}
+	if len(verr.Errs) > 0 {
+		sort.Slice(verr.Errs, func(i, j int) bool {
+			return verr.Errs[i].Error() < verr.Errs[j].Error()
+		})
+		return verr
+	}
+	return nil
+}
+
+// validateSidecar checks the inventory digest against the sidecar file
+func validateSidecar(fsys fs.FS, alg string, newHash func() hash.Hash) error {
+	name := InventoryFile + "." + alg
+	sidecar, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(sidecar))
+	if len(fields) != 2 || fields[1] != InventoryFile {
+		return fmt.Errorf("%s: invalid sidecar file", name)
+	}
+	b, err := fs.ReadFile(fsys, InventoryFile)
+	if err != nil {
+		return err
+	}
+	h := newHash()
+	h.Write(b)
+	if !strings.EqualFold(fields[0], hex.EncodeToString(h.Sum(nil))) {
+		return fmt.Errorf("%s: inventory digest mismatch", name)
+	}
+	return nil
+}
+
+// validateStructure checks the inventory's versions and digest references
+func (inv *Inventory) validateStructure() []error {
+	var errs []error
+	if inv.ID == "" {
+		errs = append(errs, errors.New(`inventory id is missing`))
+	}
+	head, err := versionNum(inv.Head)
+	if err != nil {
+		return append(errs, err)
+	}
+	if len(inv.Versions) != head {
+		errs = append(errs, fmt.Errorf("head is %s but inventory has %d versions", inv.Head, len(inv.Versions)))
+	}
+	for i := 1; i <= head; i++ {
+		v := versionName(i, versionPadding(inv.Head))
+		ver := inv.Versions[v]
+		if ver == nil {
+			errs = append(errs, fmt.Errorf("version %s is missing", v))
+			continue
+		}
+		for dig := range ver.State {
+			if _, ok := inv.Manifest[dig]; !ok {
+				errs = append(errs, fmt.Errorf("version %s state digest not in manifest: %s", v, dig))
+			}
+		}
+	}
+	return errs
+}
+
+// versionNum parses version names like "v1" or "v001"
+func versionNum(v string) (int, error) {
+	if !strings.HasPrefix(v, "v") {
+		return 0, fmt.Errorf("invalid version name: %q", v)
+	}
+	num, err := strconv.Atoi(v[1:])
+	if err != nil || num < 1 {
+		return 0, fmt.Errorf("invalid version name: %q", v)
+	}
+	return num, nil
+}
+
+// versionPadding returns the width of zero-padded version names like "v001",
+// or 0 if v is not zero-padded.
+func versionPadding(v string) int {
+	if len(v) > 2 && v[1] == '0' {
+		return len(v) - 1
+	}
+	return 0
+}
+
+// versionName returns the version name for num with the given padding
+func versionName(num int, padding int) string {
+	return fmt.Sprintf("v%0*d", padding, num)
+}
+
+// ValidationError lists the problems found by Validate()
+type ValidationError struct {
+	Errs []error
+}
+
+// Error implements error interface for ValidationError
+func (ve *ValidationError) Error() string {
+	var m []string
+	for _, err := range ve.Errs {
+		m = append(m, err.Error())
+	}
+	return "invalid OCFL object: " + strings.Join(m, `; `)
+}
@@ -0,0 +1,106 @@
+package ocfl_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/srerickson/checksum"
+	"github.com/srerickson/checksum/ocfl"
+)
+
+// copyFiles copies files (dst -> src) from srcFS to the directory dst
+func copyFiles(t *testing.T, srcFS fs.FS, dst string, files map[string]string) {
+	t.Helper()
+	for to, from := range files {
+		b, err := fs.ReadFile(srcFS, from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(dst, filepath.FromSlash(to))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAddVersionValidate(t *testing.T) {
+	obj := t.TempDir()
+	work := t.TempDir()
+	fixture := os.DirFS("../test/fixture")
+	copyFiles(t, fixture, work, map[string]string{
+		"a/file.txt": "folder1/file.txt",
+		"b/file.txt": "folder1/folder2/file2.txt", // same content as a/file.txt
+		"hello.csv":  "hello.csv",
+	})
+	inv, err := ocfl.NewInventory("ark:123/abc", checksum.SHA512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workFS := os.DirFS(work)
+	content, err := inv.AddVersion(workFS, ".", ocfl.Version{Message: "first"}, []string{checksum.MD5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) != 2 {
+		t.Fatalf("expected 2 new content files, got %d: %v", len(content), content)
+	}
+	if content["v1/content/a/file.txt"] != "a/file.txt" {
+		t.Errorf("unexpected content paths: %v", content)
+	}
+	copyFiles(t, workFS, obj, content)
+	if err := ocfl.WriteInventory(obj, inv); err != nil {
+		t.Fatal(err)
+	}
+	if err := ocfl.Validate(os.DirFS(obj)); err != nil {
+		t.Fatal(err)
+	}
+
+	// rename a file and add a new one
+	if err := os.Rename(filepath.Join(work, "hello.csv"), filepath.Join(work, "hello2.csv")); err != nil {
+		t.Fatal(err)
+	}
+	copyFiles(t, fixture, work, map[string]string{
+		"image.jpg": "folder1/folder2/sculpture-stone-face-head-888027.jpg",
+	})
+	// fixity is keyed by canonical algorithm name
+	content, err = inv.AddVersion(workFS, ".", ocfl.Version{Message: "second"}, []string{"MD5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) != 1 || content["v2/content/image.jpg"] != "image.jpg" {
+		t.Fatalf("expected 1 new content file, got %v", content)
+	}
+	if inv.Head != "v2" || len(inv.VersionState("v2")) != 4 {
+		t.Errorf("unexpected head version state: %v", inv.VersionState(inv.Head))
+	}
+	if len(inv.Fixity) != 1 || len(inv.Fixity[checksum.MD5]) != 3 {
+		t.Errorf("expected 3 md5 fixity entries, got %v", inv.Fixity)
+	}
+	copyFiles(t, workFS, obj, content)
+	if err := ocfl.WriteInventory(obj, inv); err != nil {
+		t.Fatal(err)
+	}
+	if err := ocfl.Validate(os.DirFS(obj)); err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt content
+	err = os.WriteFile(filepath.Join(obj, "v1/content/hello.csv"), []byte("bad"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ocfl.Validate(os.DirFS(obj))
+	var verr *ocfl.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(verr.Errs) != 2 {
+		t.Errorf("expected sha512 and md5 mismatch errors, got %v", verr)
+	}
+}
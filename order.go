@@ -0,0 +1,58 @@
+package checksum
+
+import "context"
+
+// DefaultOrderBuffer is the reorder buffer size used by WithOrdered() if the
+// given size is less than 1.
+const DefaultOrderBuffer = 1024
+
+// reorderBuffer is used by Walk() to call the JobFunc in the order jobs were
+// added. The number of jobs in flight (queued, in progress, or complete but
+// waiting for earlier jobs) is limited by the size of slots.
+type reorderBuffer struct {
+	slots   chan struct{} // one per job in flight
+	added   int           // sequence number for the next added job
+	next    int           // sequence number for the next job to deliver
+	pending map[int]Job   // complete jobs waiting for earlier jobs
+}
+
+func newReorderBuffer(size int) *reorderBuffer {
+	if size < 1 {
+		size = DefaultOrderBuffer
+	}
+	return &reorderBuffer{
+		slots:   make(chan struct{}, size),
+		pending: make(map[int]Job),
+	}
+}
+
+// reserve blocks until there is room in the buffer for another job and
+// returns the job's sequence number. It should be called from the go routine
+// that adds jobs.
+func (r *reorderBuffer) reserve(ctx context.Context) (int, error) {
+	select {
+	case r.slots <- struct{}{}:
+		seq := r.added
+		r.added++
+		return seq, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// push adds a complete job to the buffer and calls deliver for all jobs that
+// are next in sequence. It should be called from the go routine that
+// receives complete jobs.
+func (r *reorderBuffer) push(job Job, deliver func(Job)) {
+	r.pending[job.seq] = job
+	for {
+		next, ok := r.pending[r.next]
+		if !ok {
+			return
+		}
+		delete(r.pending, r.next)
+		r.next++
+		<-r.slots
+		deliver(next)
+	}
+}
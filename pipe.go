@@ -16,8 +16,10 @@ package checksum
 
 import (
 	"errors"
+	"io"
 	"io/fs"
 	"sync"
+	"time"
 )
 
 // A Pipe performs concurrent checksum processing. It has an input channel and
@@ -30,10 +32,12 @@ import (
 // The Close() method must be called to properly free resource of Pipes created
 // with NewPipe.
 type Pipe struct {
-	conf Config   // common config options
-	fsys fs.FS    // the pipe's jobs are scoped to the fs
-	in   chan Job // jop input
-	out  chan Job // job results
+	conf  Config          // common config options
+	fsys  fs.FS           // the pipe's jobs are scoped to the fs
+	in    chan Job        // jop input
+	out   chan Job        // job results
+	split chan *splitTask // chunks of large files for idle go routines
+	stats *pipeStats      // progress counters
 }
 
 // NewPipe returns a new Pipe scoped to fsys. The following functional options
@@ -41,12 +45,17 @@ type Pipe struct {
 //  - With[Alg](): Required
 //  - WithCtx(): context.Background().
 //  - WithNumGos():runtime.GOMAXPROCS(0)
+//  - WithProgress(): none
+//  - WithBufferSize(): DefaultBufferSize
+//  - WithThrottle(): none
 func NewPipe(fsys fs.FS, opts ...func(*Config)) (*Pipe, error) {
 	pipe := &Pipe{
-		fsys: fsys,
-		in:   make(chan Job),
-		out:  make(chan Job),
-		conf: defaultConfig(),
+		fsys:  fsys,
+		in:    make(chan Job),
+		out:   make(chan Job),
+		split: make(chan *splitTask),
+		conf:  defaultConfig(),
+		stats: newPipeStats(),
 	}
 	for _, option := range opts {
 		option(&pipe.conf)
@@ -57,24 +66,61 @@ func NewPipe(fsys fs.FS, opts ...func(*Config)) (*Pipe, error) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for job := range pipe.in {
+			w := newWorker(pipe.conf.bufferSize)
+			for {
 				select {
-				case <-pipe.conf.ctx.Done():
-					continue // clear input channel
-				default:
-					job.do()
-					pipe.out <- job
+				case job, ok := <-pipe.in:
+					if !ok {
+						return
+					}
+					select {
+					case <-pipe.conf.ctx.Done():
+						continue // clear input channel
+					default:
+						job.do(w)
+						pipe.out <- job
+					}
+				case task := <-pipe.split:
+					task.help(w)
 				}
 			}
 		}()
 	}
+	stopProgress := make(chan struct{})
+	progressStopped := make(chan struct{})
+	if pipe.conf.progressFunc != nil {
+		go func() {
+			defer close(progressStopped)
+			ticker := time.NewTicker(pipe.conf.progressInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					pipe.conf.progressFunc(pipe.Stats())
+				case <-stopProgress:
+					pipe.conf.progressFunc(pipe.Stats()) // final report
+					return
+				}
+			}
+		}()
+	} else {
+		close(progressStopped)
+	}
 	go func() {
 		wg.Wait()
+		close(stopProgress)
+		<-progressStopped
 		close(pipe.out)
 	}()
 	return pipe, nil
 }
 
+// Stats returns a snapshot of the Pipe's progress. It is safe to call from
+// any go routine.
+func (p *Pipe) Stats() Stats {
+	return p.stats.snapshot()
+}
+
 // Out returns the Pipe's recieve-only channel of Job results
 func (p *Pipe) Out() <-chan Job {
 	return p.out
@@ -94,6 +140,29 @@ func (p *Pipe) Close() {
 // not created. It causes a panic if called after Close(). To avoid deadlocks,
 // Add should be called in a separate go routine than Out().
 func (p *Pipe) Add(path string, opts ...func(*Config)) error {
+	job, err := p.newJob(path, opts...)
+	if err != nil {
+		return err
+	}
+	return p.add(job)
+}
+
+// AddReader adds a checksum job for the contents of r to the Pipe. The id is
+// used in place of a path to identify the job: it is returned by the Job's
+// Path() method. Readers that also implement io.ReaderAt and Size() (e.g.,
+// io.SectionReader) may be read concurrently as described in WithSplitSize().
+// The Pipe does not close r. Otherwise, AddReader behaves like Add().
+func (p *Pipe) AddReader(id string, r io.Reader, opts ...func(*Config)) error {
+	job, err := p.newJob(id, opts...)
+	if err != nil {
+		return err
+	}
+	job.reader = r
+	return p.add(job)
+}
+
+// newJob returns a new Job for path using the Pipe's config and opts
+func (p *Pipe) newJob(path string, opts ...func(*Config)) (Job, error) {
 	var conf Config
 	jobAlgs := p.conf.algs
 	for _, option := range opts {
@@ -103,17 +172,42 @@ func (p *Pipe) Add(path string, opts ...func(*Config)) error {
 		jobAlgs = conf.algs
 	}
 	if jobAlgs == nil {
-		return errors.New(`checksum aglorithm not set`)
+		return Job{}, errors.New(`checksum aglorithm not set`)
 	}
+	return Job{
+		path:      path,
+		fs:        p.fsys,
+		algs:      jobAlgs,
+		cache:     p.conf.cache,
+		stats:     p.stats,
+		splitSize: p.conf.splitSize,
+		helpers:   p.split,
+		ctx:       p.conf.ctx,
+		throttle:  p.conf.throttle,
+	}, nil
+}
+
+// newSymlinkJob returns a new symlink Job for path. Symlink jobs have no
+// checksums, so an algorithm isn't required.
+func (p *Pipe) newSymlinkJob(path string) Job {
+	return Job{
+		path:    path,
+		fs:      p.fsys,
+		algs:    p.conf.algs,
+		stats:   p.stats,
+		ctx:     p.conf.ctx,
+		symlink: true,
+	}
+}
+
+// add sends job to the Pipe's workers
+func (p *Pipe) add(job Job) error {
 	select {
 	case <-p.conf.ctx.Done():
 		return p.conf.ctx.Err()
 	default:
-		p.in <- Job{
-			path: path,
-			fs:   p.fsys,
-			algs: jobAlgs,
-		}
+		p.stats.queued(job.size)
+		p.in <- job
 	}
 	return nil
 
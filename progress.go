@@ -0,0 +1,119 @@
+package checksum
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateWindow is the time constant for Stats.Rate(): the weight given to past
+// throughput decays by a factor of e every RateWindow.
+const RateWindow = 2 * time.Second
+
+// Stats is a snapshot of a Pipe's progress. Byte counts for queued files are
+// only known for files added by Walk() with WithProgress(), or after the
+// file has been opened by a worker.
+type Stats struct {
+	FilesQueued int64         // number of jobs added to the Pipe
+	FilesDone   int64         // number of jobs completed
+	BytesQueued int64         // total size of queued files (when known)
+	BytesHashed int64         // bytes read and checksummed so far
+	Elapsed     time.Duration // time since the Pipe was created
+	rate        float64       // recent bytes per second
+}
+
+// BytesRemaining returns the number of bytes in queued files that have not
+// been checksummed yet. Files satisfied by a Cache are not counted.
+func (s Stats) BytesRemaining() int64 {
+	if rem := s.BytesQueued - s.BytesHashed; rem > 0 {
+		return rem
+	}
+	return 0
+}
+
+// Rate returns the current throughput in bytes per second: an exponentially
+// weighted moving average of the throughput between snapshots, with
+// RateWindow as its time constant. Unlike AverageRate(), it reflects changes
+// in throughput (e.g., from throttling or cache hits) within a few seconds,
+// so it is suitable for estimating the time to hash BytesRemaining().
+func (s Stats) Rate() float64 {
+	return s.rate
+}
+
+// AverageRate returns the average throughput in bytes per second since the
+// Pipe was created.
+func (s Stats) AverageRate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.BytesHashed) / s.Elapsed.Seconds()
+}
+
+// pipeStats are progress counters shared by a Pipe's jobs
+type pipeStats struct {
+	filesQueued int64
+	filesDone   int64
+	bytesQueued int64
+	bytesHashed int64
+	start       time.Time
+
+	mx         sync.Mutex // for the rate fields
+	rate       float64    // moving average of bytes per second
+	rateTime   time.Time  // time of the last rate sample
+	rateBytes  int64      // bytes hashed at rateTime
+	rateSample bool       // rate has been sampled
+}
+
+func newPipeStats() *pipeStats {
+	now := time.Now()
+	return &pipeStats{start: now, rateTime: now}
+}
+
+func (s *pipeStats) snapshot() Stats {
+	stats := Stats{
+		FilesQueued: atomic.LoadInt64(&s.filesQueued),
+		FilesDone:   atomic.LoadInt64(&s.filesDone),
+		BytesQueued: atomic.LoadInt64(&s.bytesQueued),
+		BytesHashed: atomic.LoadInt64(&s.bytesHashed),
+	}
+	now := time.Now()
+	stats.Elapsed = now.Sub(s.start)
+	stats.rate = s.sampleRate(now, stats.BytesHashed)
+	return stats
+}
+
+// sampleRate updates the moving average with the throughput since the last
+// sample and returns it.
+func (s *pipeStats) sampleRate(now time.Time, hashed int64) float64 {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	dt := now.Sub(s.rateTime)
+	if dt <= 0 {
+		return s.rate
+	}
+	current := float64(hashed-s.rateBytes) / dt.Seconds()
+	if s.rateSample {
+		// samples are weighted by their duration
+		weight := 1 - math.Exp(-float64(dt)/float64(RateWindow))
+		s.rate += weight * (current - s.rate)
+	} else {
+		s.rate = current
+		s.rateSample = true
+	}
+	s.rateTime, s.rateBytes = now, hashed
+	return s.rate
+}
+
+// queued records a job added to the Pipe with the expected size.
+func (s *pipeStats) queued(size int64) {
+	atomic.AddInt64(&s.filesQueued, 1)
+	atomic.AddInt64(&s.bytesQueued, size)
+}
+
+// done records a complete job. The queued byte count is adjusted so that it
+// includes the job's actual bytes read rather than its expected size.
+func (s *pipeStats) done(expected, read int64) {
+	atomic.AddInt64(&s.bytesQueued, read-expected)
+	atomic.AddInt64(&s.filesDone, 1)
+}
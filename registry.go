@@ -0,0 +1,113 @@
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// ErrUnknownAlg is returned by Lookup() for unregistered algorithms
+var ErrUnknownAlg = errors.New(`unknown checksum algorithm`)
+
+// Algorithm is a registered checksum algorithm
+type Algorithm struct {
+	Name    string           // canonical name (e.g., "sha256")
+	Aliases []string         // alternative names (e.g., "sha2-256")
+	New     func() hash.Hash // constructor
+	Size    int              // digest size in bytes
+}
+
+// registry holds all registered algorithms
+var registry = struct {
+	sync.RWMutex
+	algs  map[string]*Algorithm // by canonical name
+	names map[string]string     // normalized names and aliases -> canonical name
+}{
+	algs:  map[string]*Algorithm{},
+	names: map[string]string{},
+}
+
+func init() {
+	Register(MD5, nil, md5.New, md5.Size)
+	Register(SHA1, []string{`sha-1`}, sha1.New, sha1.Size)
+	Register(SHA256, []string{`sha2-256`}, sha256.New, sha256.Size)
+	Register(SHA512, []string{`sha2-512`}, sha512.New, sha512.Size)
+	Register(SHA384, []string{`sha2-384`}, sha512.New384, sha512.Size384)
+	Register(SHA3_256, nil, sha3.New256, 32)
+	Register(SHA3_512, nil, sha3.New512, 64)
+	Register(BLAKE2B512, []string{`blake2b`}, NewBLAKE2b512, 64)
+	Register(BLAKE3, []string{`blake3-256`}, NewBLAKE3, 32)
+	Register(XXH3, []string{`xxh3-64`}, NewXXH3, 8)
+	Register(SHA256Tree, nil, NewSHA256Tree, sha256.Size)
+}
+
+// normalizeAlgName returns name in lower case without dashes or underscores,
+// so that "SHA-256", "sha_256", and "sha256" are equivalent.
+func normalizeAlgName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(`-`, ``, `_`, ``).Replace(name)
+}
+
+// Register adds an algorithm to the registry used by Lookup(). Names and
+// aliases are matched without regard to case, dashes, or underscores. The
+// package registers md5, sha1, sha256, sha384, sha512, sha3-256, sha3-512,
+// blake2b-512, blake3, xxh3 and sha256-tree. Register panics if newHash is
+// nil or if the name or any alias is already registered.
+func Register(name string, aliases []string, newHash func() hash.Hash, size int) {
+	if newHash == nil {
+		panic(`checksum: Register constructor is nil for ` + name)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for _, n := range append([]string{name}, aliases...) {
+		if _, exists := registry.names[normalizeAlgName(n)]; exists {
+			panic(`checksum: Register called twice for ` + n)
+		}
+	}
+	alg := &Algorithm{
+		Name:    name,
+		Aliases: append([]string(nil), aliases...),
+		New:     newHash,
+		Size:    size,
+	}
+	registry.algs[name] = alg
+	for _, n := range append([]string{name}, aliases...) {
+		registry.names[normalizeAlgName(n)] = name
+	}
+}
+
+// Lookup returns the registered algorithm with the given name or alias. The
+// returned error wraps ErrUnknownAlg if the name is not registered.
+func Lookup(name string) (Algorithm, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	canonical, ok := registry.names[normalizeAlgName(name)]
+	if !ok {
+		return Algorithm{}, fmt.Errorf("%w: %q", ErrUnknownAlg, name)
+	}
+	alg := *registry.algs[canonical]
+	alg.Aliases = append([]string(nil), alg.Aliases...)
+	return alg, nil
+}
+
+// Algorithms returns the sorted canonical names of all registered
+// algorithms.
+func Algorithms() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, 0, len(registry.algs))
+	for name := range registry.algs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,185 @@
+package checksum
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/srerickson/checksum/internal/fileid"
+)
+
+// SymlinkMode determines how Walk() handles symbolic links
+type SymlinkMode int
+
+const (
+	// SymlinkSkip: symlinks are passed to the WalkDirFunc like other
+	// entries. DefaultWalkDirFunc skips them. This is the default.
+	SymlinkSkip SymlinkMode = iota
+	// SymlinkFollow: symlinks to files and directories are followed. The
+	// WalkDirFunc is called with the link's path and an entry describing the
+	// link's target. Links that would create a cycle and links whose targets
+	// don't exist are not followed.
+	SymlinkFollow
+	// SymlinkReport: symlinks are not followed but are added to the Pipe as
+	// symlink jobs (see Job.Symlink()) without calling the WalkDirFunc.
+	SymlinkReport
+)
+
+// maxLinkDepth limits the number of nested directory symlinks that are
+// followed, in case a cycle can't be detected.
+const maxLinkDepth = 40
+
+// ReadLinkFS is implemented by file systems that can read symbolic links,
+// including os.DirFS() (in Go 1.25 and later).
+type ReadLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// readLink returns the target of the symlink name in fsys
+func readLink(fsys fs.FS, name string) (string, error) {
+	rfs, ok := fsys.(ReadLinkFS)
+	if !ok {
+		return "", fmt.Errorf("reading symlink %s: %w", name, errors.ErrUnsupported)
+	}
+	return rfs.ReadLink(name)
+}
+
+// walkFollow is like fs.WalkDir except that it follows symlinks. The
+// returned error is nil if fn returns fs.SkipAll.
+func walkFollow(fsys fs.FS, root string, fn fs.WalkDirFunc) error {
+	info, err := fs.Stat(fsys, root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		w := &followWalker{fsys: fsys, fn: fn}
+		err = w.walk(root, fs.FileInfoToDirEntry(info), dirState{resolved: root})
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+type followWalker struct {
+	fsys fs.FS
+	fn   fs.WalkDirFunc
+}
+
+// dirState tracks the ancestors of a directory for cycle detection
+type dirState struct {
+	resolved  string   // path with symlinks resolved, if known
+	ancestors []string // keys for ancestor directories
+	linkDepth int      // number of followed directory symlinks
+}
+
+// key returns a string identifying the directory described by info: its
+// device and inode number if available or its resolved path.
+func (s dirState) key(info fs.FileInfo) string {
+	if id, ok := fileid.FromInfo(info); ok {
+		return fmt.Sprintf("id:%d:%d", id.Dev, id.Ino)
+	}
+	if s.resolved != "" {
+		return "path:" + s.resolved
+	}
+	return ""
+}
+
+func (s dirState) isCycle(key string) bool {
+	if s.linkDepth >= maxLinkDepth {
+		return true
+	}
+	for _, a := range s.ancestors {
+		if key != "" && a == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *followWalker) walk(name string, d fs.DirEntry, state dirState) error {
+	if err := w.fn(name, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	if info, err := d.Info(); err == nil {
+		state.ancestors = append(state.ancestors[:len(state.ancestors):len(state.ancestors)], state.key(info))
+	}
+	entries, err := fs.ReadDir(w.fsys, name)
+	if err != nil {
+		// second call, as in fs.WalkDir
+		if err = w.fn(name, d, err); err != nil {
+			if err == fs.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, e := range entries {
+		childName := path.Join(name, e.Name())
+		child := dirState{
+			ancestors: state.ancestors,
+			linkDepth: state.linkDepth,
+		}
+		if state.resolved != "" {
+			child.resolved = path.Join(state.resolved, e.Name())
+		}
+		if e.Type()&fs.ModeSymlink != 0 {
+			e, child = w.follow(childName, e, state, child)
+		}
+		if err := w.walk(childName, e, child); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// follow returns the entry and state to use for the symlink e in a
+// directory with the given state. If the link can't be followed, e is
+// returned.
+func (w *followWalker) follow(name string, e fs.DirEntry, parent, child dirState) (fs.DirEntry, dirState) {
+	info, err := fs.Stat(w.fsys, name)
+	if err != nil {
+		return e, child // dangling link
+	}
+	target := linkTargetEntry{name: e.Name(), info: info}
+	if !info.IsDir() {
+		return target, child
+	}
+	child.resolved = ""
+	if t, err := readLink(w.fsys, name); err == nil && parent.resolved != "" &&
+		!path.IsAbs(t) && !strings.HasPrefix(path.Join(parent.resolved, t), "..") {
+		child.resolved = path.Join(parent.resolved, t)
+	}
+	child.linkDepth++
+	if child.isCycle(child.key(info)) {
+		return e, child
+	}
+	return target, child
+}
+
+// IsFollowedLink returns true if d is the entry passed to a WalkDirFunc for a
+// symlink followed by Walk() with SymlinkFollow. The entry describes the
+// link's target.
+func IsFollowedLink(d fs.DirEntry) bool {
+	_, ok := d.(linkTargetEntry)
+	return ok
+}
+
+// linkTargetEntry is a DirEntry for the target of a symlink
+type linkTargetEntry struct {
+	name string
+	info fs.FileInfo
+}
+
+func (e linkTargetEntry) Name() string               { return e.name }
+func (e linkTargetEntry) IsDir() bool                { return e.info.IsDir() }
+func (e linkTargetEntry) Type() fs.FileMode          { return e.info.Mode().Type() }
+func (e linkTargetEntry) Info() (fs.FileInfo, error) { return e.info, nil }
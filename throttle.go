@@ -0,0 +1,141 @@
+package checksum
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Throttle limits the rate at which Pipes read bytes and open files. A
+// Throttle may be shared by several Pipes (see WithThrottle()), in which case
+// the limits apply to all of them together. Limits can be changed at any time
+// with SetBytesPerSec() and SetOpensPerSec(); waiting jobs use the new limits
+// immediately. A Throttle is safe for concurrent use.
+type Throttle struct {
+	mu      sync.Mutex
+	bytes   bucket
+	opens   bucket
+	changed chan struct{} // closed and replaced when limits change
+}
+
+// NewThrottle returns a Throttle that limits reads to bytesPerSec and file
+// opens to opensPerSec. A limit less than 1 means no limit.
+func NewThrottle(bytesPerSec, opensPerSec int64) *Throttle {
+	t := &Throttle{changed: make(chan struct{})}
+	now := time.Now()
+	t.bytes.setRate(bytesPerSec, now)
+	t.opens.setRate(opensPerSec, now)
+	return t
+}
+
+// SetBytesPerSec changes the Throttle's read limit. A limit less than 1 means
+// no limit.
+func (t *Throttle) SetBytesPerSec(n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bytes.setRate(n, time.Now())
+	t.notify()
+}
+
+// SetOpensPerSec changes the Throttle's file open limit. A limit less than 1
+// means no limit.
+func (t *Throttle) SetOpensPerSec(n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.opens.setRate(n, time.Now())
+	t.notify()
+}
+
+// Limits returns the Throttle's current read and file open limits. Zero
+// means no limit.
+func (t *Throttle) Limits() (bytesPerSec, opensPerSec int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return int64(t.bytes.rate), int64(t.opens.rate)
+}
+
+// notify wakes waiting jobs so they use the new limits. t.mu must be held.
+func (t *Throttle) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// waitBytes blocks until n bytes may be read or ctx is done.
+func (t *Throttle) waitBytes(ctx context.Context, n int) error {
+	return t.wait(ctx, &t.bytes, float64(n))
+}
+
+// waitOpen blocks until a file may be opened or ctx is done.
+func (t *Throttle) waitOpen(ctx context.Context) error {
+	return t.wait(ctx, &t.opens, 1)
+}
+
+func (t *Throttle) wait(ctx context.Context, b *bucket, n float64) error {
+	for {
+		t.mu.Lock()
+		delay := b.take(time.Now(), n)
+		changed := t.changed
+		t.mu.Unlock()
+		if delay == 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// bucket is a token bucket that holds at most one second's worth of tokens.
+// Tokens may go negative: a large request is allowed as long as the bucket
+// isn't in debt, and later requests wait for the debt to be repaid. This
+// keeps the average rate at the limit regardless of read sizes.
+type bucket struct {
+	rate   float64 // tokens per second; 0 for unlimited
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) setRate(rate int64, now time.Time) {
+	b.refill(now)
+	if rate < 1 {
+		rate = 0
+	}
+	b.rate = float64(rate)
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b.rate > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+}
+
+// take removes n tokens from the bucket if it isn't in debt. Otherwise, it
+// returns how long to wait before trying again.
+func (b *bucket) take(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	if b.rate == 0 {
+		return 0
+	}
+	if b.tokens < 0 {
+		wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+		if wait < time.Millisecond {
+			wait = time.Millisecond
+		}
+		return wait
+	}
+	b.tokens -= n
+	return 0
+}
@@ -0,0 +1,231 @@
+package checksum
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// SHA256Tree is the name of the SHA-256 tree hash algorithm used by AWS
+// Glacier: SHA-256 digests of 1 MiB chunks are combined pairwise until a
+// single digest remains.
+const SHA256Tree = `sha256-tree`
+
+// TreeHash is implemented by hashes computed from the digests of fixed size
+// chunks. Chunks of large files can be hashed concurrently (see
+// WithSplitSize()), so ChunkSum and SumChunks must be safe for concurrent
+// use.
+type TreeHash interface {
+	hash.Hash
+	// ChunkSize returns the size of chunks in bytes.
+	ChunkSize() int
+	// ChunkSum returns the digest of a single chunk. Only the final chunk
+	// may be shorter than ChunkSize().
+	ChunkSum(chunk []byte) []byte
+	// SumChunks returns the digest for the ordered digests of all chunks.
+	SumChunks(sums [][]byte) []byte
+}
+
+const treeChunkSize = 1024 * 1024
+
+// treeSHA256 implements TreeHash for SHA256Tree
+type treeSHA256 struct {
+	buf    []byte   // incomplete chunk
+	leaves [][]byte // digests of complete chunks
+}
+
+// NewSHA256Tree returns a new hash.Hash computing the SHA256Tree digest.
+func NewSHA256Tree() hash.Hash {
+	return &treeSHA256{buf: make([]byte, 0, treeChunkSize)}
+}
+
+func (t *treeSHA256) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		space := treeChunkSize - len(t.buf)
+		if space > len(p) {
+			space = len(p)
+		}
+		t.buf = append(t.buf, p[:space]...)
+		p = p[space:]
+		if len(t.buf) == treeChunkSize {
+			t.leaves = append(t.leaves, t.ChunkSum(t.buf))
+			t.buf = t.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+func (t *treeSHA256) Sum(b []byte) []byte {
+	leaves := t.leaves
+	if len(t.buf) > 0 || len(leaves) == 0 {
+		leaves = append(leaves[:len(leaves):len(leaves)], t.ChunkSum(t.buf))
+	}
+	return append(b, t.SumChunks(leaves)...)
+}
+
+func (t *treeSHA256) Reset() {
+	t.buf = t.buf[:0]
+	t.leaves = nil
+}
+
+func (t *treeSHA256) Size() int      { return sha256.Size }
+func (t *treeSHA256) BlockSize() int { return sha256.BlockSize }
+func (t *treeSHA256) ChunkSize() int { return treeChunkSize }
+
+func (t *treeSHA256) ChunkSum(chunk []byte) []byte {
+	sum := sha256.Sum256(chunk)
+	return sum[:]
+}
+
+func (t *treeSHA256) SumChunks(sums [][]byte) []byte {
+	if len(sums) == 0 {
+		return t.ChunkSum(nil)
+	}
+	level := sums
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := sha256.New()
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return append([]byte(nil), level[0]...)
+}
+
+// splitSums returns checksums for the Job's algorithms by reading chunks of r
+// concurrently: the worker reads chunks itself and offers the remaining
+// chunks to the Pipe's idle workers. It returns nil (and no error) if any of
+// the Job's algorithms is not a TreeHash or if they have different chunk
+// sizes.
+func (j *Job) splitSums(w *worker, r io.ReaderAt, size int64) (map[string][]byte, error) {
+	hashes := make(map[string]TreeHash)
+	chunkSize := 0
+	for name, f := range j.algs {
+		th, ok := f.new().(TreeHash)
+		if !ok || (chunkSize != 0 && th.ChunkSize() != chunkSize) {
+			return nil, nil
+		}
+		chunkSize = th.ChunkSize()
+		hashes[name] = th
+	}
+	t := &splitTask{
+		job:       j,
+		r:         r,
+		size:      size,
+		chunkSize: chunkSize,
+		numChunks: (size + int64(chunkSize) - 1) / int64(chunkSize),
+		hashes:    hashes,
+		leaves:    make(map[string][][]byte),
+	}
+	for name := range hashes {
+		t.leaves[name] = make([][]byte, t.numChunks)
+	}
+	for {
+		t.offer(j.helpers)
+		if !t.step(w) {
+			break
+		}
+	}
+	t.helpers.Wait()
+	if t.err != nil {
+		return nil, t.err
+	}
+	sums := make(map[string][]byte)
+	for name, th := range hashes {
+		sums[name] = th.SumChunks(t.leaves[name])
+	}
+	return sums, nil
+}
+
+// splitTask is a file being checksummed in chunks by one of a Pipe's workers
+// with help from idle workers. Each chunk is claimed by exactly one worker.
+type splitTask struct {
+	job       *Job
+	r         io.ReaderAt
+	size      int64
+	chunkSize int
+	numChunks int64
+	hashes    map[string]TreeHash
+	leaves    map[string][][]byte // chunk digests by algorithm
+	next      int64               // next unclaimed chunk (atomic)
+	helpers   sync.WaitGroup      // workers helping with the task
+	mx        sync.Mutex
+	err       error // first error reading a chunk
+}
+
+// offer sends the task to idle workers on helpers, without blocking, while
+// there are unclaimed chunks.
+func (t *splitTask) offer(helpers chan<- *splitTask) {
+	for atomic.LoadInt64(&t.next) < t.numChunks {
+		t.helpers.Add(1)
+		select {
+		case helpers <- t:
+		default:
+			t.helpers.Done() // no idle workers
+			return
+		}
+	}
+}
+
+// help hashes chunks using w until none are left. It is called by workers
+// that receive the task from offer().
+func (t *splitTask) help(w *worker) {
+	defer t.helpers.Done()
+	for t.step(w) {
+	}
+}
+
+// step claims and hashes the next chunk. It returns false if there are no
+// chunks left or if the task failed.
+func (t *splitTask) step(w *worker) bool {
+	t.mx.Lock()
+	failed := t.err != nil
+	t.mx.Unlock()
+	if failed {
+		return false
+	}
+	idx := atomic.AddInt64(&t.next, 1) - 1
+	if idx >= t.numChunks {
+		return false
+	}
+	j := t.job
+	buf := w.chunkBuffer(t.chunkSize)
+	off := idx * int64(t.chunkSize)
+	n, err := t.r.ReadAt(buf, off)
+	if err != nil && !(err == io.EOF && off+int64(n) == t.size) {
+		t.fail(err)
+		return false
+	}
+	if j.stats != nil {
+		atomic.AddInt64(&j.read, int64(n))
+		atomic.AddInt64(&j.stats.bytesHashed, int64(n))
+	}
+	if j.throttle != nil {
+		if err := j.throttle.waitBytes(j.ctx, n); err != nil {
+			t.fail(err)
+			return false
+		}
+	}
+	for name, th := range t.hashes {
+		t.leaves[name][idx] = th.ChunkSum(buf[:n])
+	}
+	return true
+}
+
+func (t *splitTask) fail(err error) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if t.err == nil {
+		t.err = err
+	}
+}
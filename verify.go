@@ -0,0 +1,153 @@
+package checksum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/srerickson/checksum/delta"
+)
+
+// VerifyStatus describes the result of verifying a single file
+type VerifyStatus int
+
+const (
+	// VerifyOK: the file's digest matches the manifest
+	VerifyOK VerifyStatus = iota
+	// VerifyFailed: the file's digest does not match the manifest
+	VerifyFailed
+	// VerifyMissing: the file is in the manifest but not found
+	VerifyMissing
+	// VerifyExtra: the file was found but is not in the manifest
+	VerifyExtra
+	// VerifyError: the file could not be read
+	VerifyError
+)
+
+// String returns the status as it is reported by sha256sum -c and friends.
+func (s VerifyStatus) String() string {
+	switch s {
+	case VerifyOK:
+		return `OK`
+	case VerifyFailed:
+		return `FAILED`
+	case VerifyMissing:
+		return `MISSING`
+	case VerifyExtra:
+		return `EXTRA`
+	case VerifyError:
+		return `ERROR`
+	}
+	return fmt.Sprintf(`VerifyStatus(%d)`, int(s))
+}
+
+// VerifyResult is the result of verifying a single file
+type VerifyResult struct {
+	Path     string       // path in the manifest or in the FS
+	Status   VerifyStatus // verification result
+	Expected string       // digest from the manifest (if any)
+	Got      string       // digest calculated from the file (if any)
+	Err      error        // error for VerifyError and VerifyMissing
+}
+
+// Verify checks the files in fsys against manifest, a map of paths to hex
+// encoded digests. Exactly one algorithm must be configured with the
+// functional options (e.g., WithSHA256()); it is used to calculate digests for
+// each file in the manifest. Files are checksummed concurrently as in Walk().
+// If WithExtraFiles() is used, fsys is also walked from "." to find files that
+// are not in the manifest; WithInclude(), WithExclude() and WithIgnoreFiles()
+// apply to this walk. Results are sorted by path. The returned error is
+// only non-nil if verification could not be completed; use the results to
+// determine whether verification was successful.
+func Verify(fsys fs.FS, manifest delta.FileSet, opts ...func(*Config)) ([]VerifyResult, error) {
+	conf := defaultConfig()
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	if len(conf.algs) != 1 {
+		return nil, errors.New(`verify requires exactly one checksum algorithm`)
+	}
+	var alg string
+	for name := range conf.algs {
+		alg = name
+	}
+	var cancel context.CancelFunc
+	conf.ctx, cancel = context.WithCancel(conf.ctx)
+	defer cancel()
+	p, err := NewPipe(fsys, withConfig(&conf))
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(manifest))
+	for path := range manifest {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	addErrChan := make(chan error, 1)
+	go func() {
+		defer p.Close()
+		defer close(addErrChan)
+		for _, path := range paths {
+			if err := p.Add(path); err != nil {
+				addErrChan <- err
+				return
+			}
+		}
+	}()
+	results := make([]VerifyResult, 0, len(manifest))
+	for job := range p.Out() {
+		result := VerifyResult{
+			Path:     job.Path(),
+			Expected: strings.ToLower(manifest[job.Path()]),
+		}
+		switch {
+		case errors.Is(job.Err(), fs.ErrNotExist):
+			result.Status = VerifyMissing
+			result.Err = job.Err()
+		case job.Err() != nil:
+			result.Status = VerifyError
+			result.Err = job.Err()
+		default:
+			result.Got, _ = job.SumString(alg)
+			result.Status = VerifyOK
+			if result.Got != result.Expected {
+				result.Status = VerifyFailed
+			}
+		}
+		results = append(results, result)
+	}
+	if err := <-addErrChan; err != nil {
+		return nil, err
+	}
+	if conf.verifyExtra {
+		walk := func(path string, d fs.DirEntry, e error) error {
+			if err := conf.walkDirFunc(path, d, e); err != nil {
+				if err == ErrSkipFile {
+					return nil
+				}
+				return err
+			}
+			if _, exists := manifest[path]; !exists {
+				results = append(results, VerifyResult{
+					Path:   path,
+					Status: VerifyExtra,
+				})
+			}
+			return nil
+		}
+		filter, err := newWalkFilter(fsys, `.`, &conf)
+		if err != nil {
+			return nil, err
+		}
+		if err := fs.WalkDir(fsys, `.`, filter.wrap(walk)); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+	return results, nil
+}
@@ -3,6 +3,7 @@ package checksum
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/fs"
 	"strings"
 )
@@ -59,38 +60,112 @@ func Walk(fsys fs.FS, root string, each JobFunc, opts ...func(*Config)) error {
 	var cancel context.CancelFunc
 	conf.ctx, cancel = context.WithCancel(conf.ctx)
 
+	filter, err := newWalkFilter(fsys, root, &conf)
+	if err != nil {
+		cancel()
+		return err
+	}
+	var cp *checkpoint
+	if conf.checkpoint != "" {
+		if cp, err = openCheckpoint(conf.checkpoint, conf.resume); err != nil {
+			cancel()
+			return err
+		}
+	}
 	p, err := NewPipe(fsys, withConfig(&conf))
 	if err != nil {
 		cancel()
+		if cp != nil {
+			cp.close()
+		}
 		return err
 	}
+	var reorder *reorderBuffer
+	if conf.ordered {
+		reorder = newReorderBuffer(conf.orderBuffer)
+	}
 	walkErrChan := make(chan error, 1)
 	go func() {
 		defer p.Close()
 		defer close(walkErrChan)
+		// add adds job to the pipe, reserving its place in the output order
+		add := func(job Job) error {
+			if reorder != nil {
+				var err error
+				if job.seq, err = reorder.reserve(p.conf.ctx); err != nil {
+					return err
+				}
+			}
+			return p.add(job)
+		}
 		walk := func(path string, d fs.DirEntry, e error) error {
+			if e == nil && p.conf.symlinks == SymlinkReport && d.Type()&fs.ModeSymlink != 0 {
+				job := p.newSymlinkJob(path)
+				var err error
+				if job.info, err = d.Info(); err != nil {
+					return err
+				}
+				return add(job)
+			}
 			if err := p.conf.walkDirFunc(path, d, e); err != nil {
 				if err == ErrSkipFile {
 					return nil // continue walk but no checksum
 				}
 				return err
 			}
-			return p.Add(path)
+			job, err := p.newJob(path)
+			if err != nil {
+				return err
+			}
+			if cp != nil && cp.has(path) {
+				if info, err := d.Info(); err == nil {
+					if sums := cp.get(path, info, job.algNames()); sums != nil {
+						job.sums, job.info, job.resumed = sums, info, true
+					}
+				}
+			}
+			if p.conf.progressFunc != nil {
+				if info, err := d.Info(); err == nil {
+					job.size = info.Size()
+				}
+			}
+			return add(job)
+		}
+		if p.conf.symlinks == SymlinkFollow {
+			walkErrChan <- walkFollow(fsys, root, filter.wrap(walk))
+			return
 		}
-		walkErrChan <- fs.WalkDir(fsys, root, walk)
+		walkErrChan <- fs.WalkDir(fsys, root, filter.wrap(walk))
 	}()
 
 	// process job callbacks and capture errors
 	var jobFuncErr error
-	for complete := range p.Out() {
+	deliver := func(complete Job) {
 		if jobFuncErr == nil {
 			jobFuncErr = each(complete, complete.Err())
+			if jobFuncErr == nil && cp != nil && complete.Err() == nil && !complete.resumed {
+				if err := cp.record(complete); err != nil {
+					jobFuncErr = fmt.Errorf(`checkpoint: %w`, err)
+				}
+			}
 			if jobFuncErr != nil {
 				cancel()
 			}
 		}
 	}
+	for complete := range p.Out() {
+		if reorder != nil {
+			reorder.push(complete, deliver)
+			continue
+		}
+		deliver(complete)
+	}
 	walkErr := <-walkErrChan
+	if cp != nil {
+		if err := cp.close(); err != nil && jobFuncErr == nil {
+			jobFuncErr = fmt.Errorf(`checkpoint: %w`, err)
+		}
+	}
 	if jobFuncErr != nil || walkErr != nil {
 		cancel()
 		return &WalkErr{
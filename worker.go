@@ -0,0 +1,121 @@
+package checksum
+
+import (
+	"hash"
+	"io"
+	"sync/atomic"
+)
+
+// DefaultBufferSize is the size of the read buffer used by each of a Pipe's
+// go routines if WithBufferSize() is not set.
+const DefaultBufferSize = 32 * 1024
+
+// worker holds resources that a Pipe go routine reuses for each job: a read
+// buffer and the hashes for the most recent set of algorithms. Hashes are
+// Reset() rather than reallocated when consecutive jobs use the same
+// algorithms from the same WithAlg() options, which is the case unless
+// algorithms are given to Add().
+type worker struct {
+	buf    []byte
+	chunk  []byte     // for chunks of split jobs
+	names  []string   // algorithm names for hashes
+	funcs  []*algFunc // constructors for hashes
+	hashes []hash.Hash
+}
+
+func newWorker(bufSize int) *worker {
+	if bufSize < 1 {
+		bufSize = DefaultBufferSize
+	}
+	return &worker{buf: make([]byte, bufSize)}
+}
+
+// chunkBuffer returns a buffer of the given size for reading chunks of split
+// jobs (see WithSplitSize()).
+func (w *worker) chunkBuffer(size int) []byte {
+	if cap(w.chunk) < size {
+		w.chunk = make([]byte, size)
+	}
+	return w.chunk[:size]
+}
+
+// hashesFor returns reset hashes for algs and their names, in the same order.
+func (w *worker) hashesFor(algs map[string]*algFunc) ([]string, []hash.Hash) {
+	if w.sameAlgs(algs) {
+		for _, h := range w.hashes {
+			h.Reset()
+		}
+		return w.names, w.hashes
+	}
+	w.names = w.names[:0]
+	w.funcs = w.funcs[:0]
+	w.hashes = w.hashes[:0]
+	for name, f := range algs {
+		w.names = append(w.names, name)
+		w.funcs = append(w.funcs, f)
+		w.hashes = append(w.hashes, f.new())
+	}
+	return w.names, w.hashes
+}
+
+// sameAlgs returns true if the worker has hashes for exactly the algorithms in
+// algs: the same names with the same constructors.
+func (w *worker) sameAlgs(algs map[string]*algFunc) bool {
+	if len(w.hashes) == 0 || len(algs) != len(w.names) {
+		return false
+	}
+	for i, name := range w.names {
+		if algs[name] != w.funcs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// readSums reads r sequentially into the worker's buffer and returns
+// checksums for all the job's algorithms.
+func (w *worker) readSums(j *Job, r io.Reader) (map[string][]byte, error) {
+	names, hashes := w.hashesFor(j.algs)
+	if err := w.copy(j, hashes, r); err != nil {
+		return nil, err
+	}
+	sums := make(map[string][]byte, len(hashes))
+	for i, h := range hashes {
+		sums[names[i]] = h.Sum(nil)
+	}
+	return sums, nil
+}
+
+// copy writes the contents of r to hashes using the worker's buffer. Unlike
+// io.CopyBuffer, it never uses io.WriterTo or io.ReaderFrom, which may
+// allocate their own buffers.
+func (w *worker) copy(j *Job, hashes []hash.Hash, r io.Reader) error {
+	for {
+		n, err := r.Read(w.buf)
+		if n > 0 {
+			// hash.Hash Write never returns an error
+			if len(hashes) == 1 {
+				hashes[0].Write(w.buf[:n]) // single algorithm fast path
+			} else {
+				for _, h := range hashes {
+					h.Write(w.buf[:n])
+				}
+			}
+			if j.stats != nil {
+				j.read += int64(n)
+				atomic.AddInt64(&j.stats.bytesHashed, int64(n))
+			}
+			if j.throttle != nil {
+				if err := j.throttle.waitBytes(j.ctx, n); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}